@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"deployer/internal/config"
+	"deployer/internal/infrastructure"
+	"deployer/pkg/logger"
+)
+
+// runLockCommand implements "deployer lock status" and
+// "deployer lock force-unlock <name>".
+func runLockCommand(args []string, log *logger.Logger) {
+	usage := func() {
+		fmt.Println("Usage: deployer lock status [-config deployment.config.json]")
+		fmt.Println("       deployer lock force-unlock [-config deployment.config.json] <service|host>")
+		os.Exit(1)
+	}
+	if len(args) == 0 {
+		usage()
+	}
+
+	flags := flag.NewFlagSet("lock "+args[0], flag.ExitOnError)
+	configFile := flags.String("config", "deployment.config.json", "Configuration file path")
+	logging := addLogFlags(flags)
+	flags.Parse(args[1:])
+	logging.apply(log)
+
+	cfg, err := config.NewRepository().LoadConfig(*configFile)
+	if err != nil {
+		log.Error("Failed to load config: %v", err)
+		os.Exit(1)
+	}
+
+	sshService := infrastructure.NewSSHService(cfg.SSH, log, false)
+	sshService.SetSecrets(infrastructure.ConfigSecrets(cfg))
+	if err := sshService.Connect(cfg.SSH); err != nil {
+		log.Error("%v", err)
+		os.Exit(1)
+	}
+	lockService := infrastructure.NewRemoteLockService(sshService, cfg.Lock.Dir, log, false)
+
+	switch args[0] {
+	case "status":
+		locks, err := lockService.List()
+		if err != nil {
+			log.Error("%v", err)
+			os.Exit(1)
+		}
+		if len(locks) == 0 {
+			fmt.Printf("No deployment locks held on %s\n", cfg.SSH.Host)
+			return
+		}
+		for _, lock := range locks {
+			state := "expires " + lock.ExpiresAt.Local().Format(time.RFC1123)
+			if time.Now().After(lock.ExpiresAt) {
+				state = "EXPIRED"
+			}
+			fmt.Printf("  - %s\n", lock.Name)
+			fmt.Printf("    Owner: %s@%s (pid %d)\n", lock.Owner, lock.Machine, lock.PID)
+			fmt.Printf("    Run: %s\n", lock.ID)
+			fmt.Printf("    Since: %s (%s)\n", lock.StartedAt.Local().Format(time.RFC1123), state)
+		}
+	case "force-unlock":
+		if flags.NArg() != 1 {
+			usage()
+		}
+		if err := lockService.ForceUnlock(flags.Arg(0)); err != nil {
+			log.Error("%v", err)
+			os.Exit(1)
+		}
+	default:
+		usage()
+	}
+}
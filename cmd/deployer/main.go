@@ -3,7 +3,11 @@ package main
 import (
     "flag"
     "fmt"
+    "io"
     "os"
+    "path/filepath"
+    "sort"
+    "strings"
 
     "deployer/internal/config"
     "deployer/internal/domain"
@@ -11,23 +15,64 @@ import (
     "deployer/internal/ui"
     "deployer/internal/usecase"
     "deployer/pkg/logger"
+    "deployer/pkg/terminal"
 )
 
 func main() {
     var (
-        configFile   = flag.String("config", "deployment.config.json", "Configuration file path")
-        service      = flag.String("service", "", "Service name to deploy")
-        version      = flag.String("version", "", "Version tag for the image")
-        buildPath    = flag.String("build-path", "", "Path where to run docker build (optional, overrides config)")
-        dryRun       = flag.Bool("dry-run", false, "Show commands without executing")
-        listServices = flag.Bool("list", false, "List available services from config")
+        configFile     = flag.String("config", "deployment.config.json", "Configuration file path")
+        service        = flag.String("service", "", "Service name to deploy (comma-separated for several)")
+        all            = flag.Bool("all", false, "Deploy all services from config in dependency order")
+        version        = flag.String("version", "", "Version tag for the image (default: derived from git)")
+        buildPath      = flag.String("build-path", "", "Path where to run docker build (optional, overrides config)")
+        dryRun         = flag.Bool("dry-run", false, "Show commands without executing")
+        listServices   = flag.Bool("list", false, "List available services from config")
+        resume         = flag.String("resume", "", "Resume a failed deployment run by its run ID")
+        fromStep       = flag.String("from-step", "", "Start the pipeline at the first step of this type (e.g. pull)")
+        skipSteps      = flag.String("skip", "", "Comma-separated step types to skip (e.g. build,push)")
+        planFormat     = flag.String("plan", "", "Print the execution plan as text, json or script (implies -dry-run)")
+        planOut        = flag.String("plan-out", "", "Write the execution plan to this file instead of stdout")
+        force          = flag.Bool("force", false, "Overwrite an existing registry tag, or resume with a tag pushed again since the run")
+        allowDirty     = flag.Bool("allow-dirty", false, "Deploy uncommitted changes to production")
+        allowDowngrade = flag.Bool("allow-downgrade", false, "Deploy a version lower than the running one to a service with \"downgrade\": \"block\"")
+        bump           = flag.String("bump", "", "Bump the latest version instead of giving -version: patch, minor or major")
+        progressMode   = flag.String("progress", ui.ProgressAuto, "Progress output: auto, bar, plain, json or none")
+        logging        = addLogFlags(flag.CommandLine)
     )
-    flag.Parse()
 
     // Initialize dependencies
     log := logger.New("deployer")
+    if err := log.SetFormat(envOr("DEPLOYER_LOG_FORMAT", logger.FormatText)); err != nil {
+        log.Error("DEPLOYER_LOG_FORMAT: %v", err)
+        os.Exit(1)
+    }
+    log.SetDebug(os.Getenv("DEPLOYER_DEBUG") != "" && os.Getenv("DEPLOYER_DEBUG") != "0")
+    log.SetColor(terminal.ColorEnabled(os.Stderr))
     configRepo := config.NewRepository()
 
+    // "deployer deploy ..." is the same as "deployer ..."
+    args := os.Args[1:]
+    if len(args) > 0 {
+        switch args[0] {
+        case "deploy":
+            args = args[1:]
+        case "lock":
+            runLockCommand(args[1:], log)
+            return
+        case "tags":
+            runTagsCommand(args[1:], log)
+            return
+        case "prune":
+            runPruneCommand(args[1:], log)
+            return
+        case "registry":
+            runRegistryCommand(args[1:], log)
+            return
+        }
+    }
+    flag.CommandLine.Parse(args)
+    logging.apply(log)
+
     if *listServices {
         cli := ui.NewCLI(configRepo, nil, log)
         cli.ListServices(*configFile)
@@ -35,18 +80,55 @@ func main() {
     }
 
     // Interactive mode if no arguments provided
-    if *service == "" || *version == "" {
+    if *resume == "" && *service == "" && !*all {
         if len(os.Args) == 1 {
             // Initialize all services for interactive mode
             dockerService := infrastructure.NewDockerService(log, false)
             sshService := infrastructure.NewSSHService(domain.SSHConfig{}, log, false)
-            deploymentService := usecase.NewDeploymentService(dockerService, sshService, log)
+            remoteDocker := infrastructure.NewRemoteDockerCLI(sshService, log)
+            shellService := infrastructure.NewShellService(log, false)
+            runStore := infrastructure.NewFileRunStore(filepath.Join(config.DefaultStateDir, "runs"))
+            lockService := infrastructure.NewRemoteLockService(sshService, config.DefaultLockDir, log, false)
+            var registry domain.RegistryService
+            var notifications domain.NotificationsConfig
+            cfg, err := configRepo.LoadConfig(*configFile)
+            if err == nil {
+                registry = infrastructure.NewRegistryClient(cfg.Registry)
+                notifications = cfg.Notifications
+            }
+            ignored := []string{config.DefaultStateDir}
+            if err == nil {
+                ignored = []string{cfg.StateDir, cfg.Logs.Dir}
+            }
+            gitService := infrastructure.NewGitService(ignored...)
+            deploymentService := usecase.NewDeploymentService(dockerService, remoteDocker, registry, sshService, shellService, gitService, runStore, lockService, infrastructure.NewFieldLogger(log))
+            if err == nil {
+                setDeploymentLog(deploymentService, cfg, log)
+            }
+            progress, _ := ui.NewProgress(ui.ProgressAuto, os.Stdout, terminal.IsTerminal(os.Stdout), terminal.ColorEnabled(os.Stdout))
+            deploymentService.SetProgress(progress)
+            if err := addNotifiers(deploymentService, notifications); err != nil {
+                log.Error("Failed to set up notifications: %v", err)
+                os.Exit(1)
+            }
             cli := ui.NewCLI(configRepo, deploymentService, log)
+            cli.SetRegistry(registry)
+            cli.SetSourceControl(gitService)
+            cli.SetOperator(infrastructure.CurrentUser())
+            cli.SetColor(terminal.ColorEnabled(os.Stdout))
             
             cli.RunInteractiveMode(*configFile)
             return
         }
-        fmt.Println("Usage: deployer -service <service-name> -version <version> [-config deployment.config.json] [-build-path /path/to/build] [-dry-run]")
+        fmt.Println("Usage: deployer -service <service-name>[,<service-name>...] [-version <version>] [-config deployment.config.json] [-build-path /path/to/build] [-dry-run] [-force] [-allow-dirty] [-allow-downgrade]")
+        fmt.Println("       deployer -service <service-name> -bump patch|minor|major [-config deployment.config.json]")
+        fmt.Println("       deployer -all [-version <version>] [-config deployment.config.json] [-dry-run]")
+        fmt.Println("       deployer deploy -resume <run-id> [-from-step <step>] [-skip <step>,...]")
+        fmt.Println("       deployer -service <service-name> -version <version> -plan text|json|script [-plan-out plan.sh]")
+        fmt.Println("       deployer lock status|force-unlock [-config deployment.config.json]")
+        fmt.Println("       deployer tags -service <service-name> [-digests] [-config deployment.config.json]")
+        fmt.Println("       deployer prune [-service <service-name>[,...]] [-keep <n>] [-dry-run] [-config deployment.config.json]")
+        fmt.Println("       deployer registry prune -service <service-name> [-keep 20] [-older-than 90d] [-grace 30d] [-dry-run]")
         fmt.Println("       deployer -list [-config deployment.config.json]")
         os.Exit(1)
     }
@@ -59,29 +141,128 @@ func main() {
     }
 
     serviceNames := configRepo.GetServiceNames(config)
-    serviceExists := false
-    for _, name := range serviceNames {
-        if name == *service {
-            serviceExists = true
-            break
+    sort.Strings(serviceNames)
+
+    var selected []string
+    if *all {
+        selected = serviceNames
+    } else {
+        for _, name := range strings.Split(*service, ",") {
+            if name = strings.TrimSpace(name); name != "" {
+                selected = append(selected, name)
+            }
+        }
+    }
+
+    var skipped []string
+    for _, kind := range strings.Split(*skipSteps, ",") {
+        if kind = strings.TrimSpace(kind); kind != "" {
+            skipped = append(skipped, kind)
         }
     }
 
-    if !serviceExists {
-        log.Error("Service '%s' not found in config. Available services: %v", *service, serviceNames)
+    if len(selected) == 0 && *resume == "" {
+        log.Error("No services selected. Available services: %v", serviceNames)
+        os.Exit(1)
+    }
+
+    for _, name := range selected {
+        serviceExists := false
+        for _, known := range serviceNames {
+            if known == name {
+                serviceExists = true
+                break
+            }
+        }
+
+        if !serviceExists {
+            log.Error("Service '%s' not found in config. Available services: %v", name, serviceNames)
+            os.Exit(1)
+        }
+    }
+
+    if *bump != "" && *version != "" {
+        log.Error("-bump and -version cannot be used together")
+        os.Exit(1)
+    }
+
+    if len(selected) > 1 && *buildPath != "" {
+        log.Error("-build-path can only be used when deploying a single service")
         os.Exit(1)
     }
 
     // Initialize services
-    dockerService := infrastructure.NewDockerService(log, *dryRun)
+    if *planFormat != "" {
+        if err := ui.WritePlan(io.Discard, domain.Plan{}, *planFormat); err != nil {
+            log.Error("%v", err)
+            os.Exit(1)
+        }
+        *dryRun = true
+    }
+
+    cliDocker := infrastructure.NewDockerService(log, *dryRun)
+    cliDocker.SetStreamOutput(log.Format() == logger.FormatText)
+    var dockerService domain.DockerService = cliDocker
+    // Plans always use the CLI so that the plan script can be executed.
+    if config.Docker.Client == "api" && *planFormat == "" {
+        apiDocker, err := infrastructure.NewDockerAPIService(config.Docker.Host, log, *dryRun)
+        if err != nil {
+            log.Error("Failed to set up Docker Engine API client: %v", err)
+            os.Exit(1)
+        }
+        dockerService = apiDocker
+    }
     sshService := infrastructure.NewSSHService(config.SSH, log, *dryRun)
-    deploymentService := usecase.NewDeploymentService(dockerService, sshService, log)
+    sshService.SetSecrets(infrastructure.ConfigSecrets(config))
+    var remoteDocker domain.RemoteDockerService = infrastructure.NewRemoteDockerCLI(sshService, log)
+    if config.Docker.RemoteClient == "api" && *planFormat == "" {
+        remoteDocker = infrastructure.NewRemoteDockerAPI(sshService, config.Docker.RemoteSocket, log, *dryRun)
+    }
+    shellService := infrastructure.NewShellService(log, *dryRun)
+    runStore := infrastructure.NewFileRunStore(filepath.Join(config.StateDir, "runs"))
+    lockService := infrastructure.NewRemoteLockService(sshService, config.Lock.Dir, log, *dryRun)
+    registry := infrastructure.NewRegistryClient(config.Registry)
+    deploymentService := usecase.NewDeploymentService(dockerService, remoteDocker, registry, sshService, shellService, infrastructure.NewGitService(config.StateDir, config.Logs.Dir), runStore, lockService, infrastructure.NewFieldLogger(log))
+    if *planFormat != "" {
+        *progressMode = ui.ProgressNone
+    }
+    progress, err := ui.NewProgress(*progressMode, os.Stdout, terminal.IsTerminal(os.Stdout), !*logging.noColor && terminal.ColorEnabled(os.Stdout))
+    if err != nil {
+        log.Error("%v", err)
+        os.Exit(1)
+    }
+    deploymentService.SetProgress(progress)
+    if err := addNotifiers(deploymentService, config.Notifications); err != nil {
+        log.Error("Failed to set up notifications: %v", err)
+        os.Exit(1)
+    }
+    setDeploymentLog(deploymentService, config, log)
+
+    var recorder *infrastructure.PlanRecorder
+    if *planFormat != "" {
+        recorder = infrastructure.NewPlanRecorder(map[string]string{
+            "DEPLOYER_REGISTRY_PASSWORD": config.Registry.Password,
+            "DEPLOYER_SSH_PASSWORD":      config.SSH.Password,
+        })
+        cliDocker.SetRecorder(recorder)
+        sshService.SetRecorder(recorder)
+        shellService.SetRecorder(recorder)
+        deploymentService.SetRecorder(recorder)
+    }
 
     request := domain.DeploymentRequest{
-        ServiceName:       *service,
+        ServiceNames:      selected,
         Version:          *version,
         BuildPathOverride: *buildPath,
         DryRun:           *dryRun,
+        ResumeRunID:       *resume,
+        FromStep:          *fromStep,
+        SkipSteps:         skipped,
+        Force:             *force,
+        AllowDirty:        *allowDirty,
+        AllowDowngrade:    *allowDowngrade,
+        Bump:              *bump,
+        Operator:          infrastructure.CurrentUser(),
     }
 
     if err := deploymentService.Deploy(request, config); err != nil {
@@ -89,5 +270,96 @@ func main() {
         os.Exit(1)
     }
 
+    if recorder != nil {
+        out := os.Stdout
+        if *planOut != "" {
+            file, err := os.Create(*planOut)
+            if err != nil {
+                log.Error("Failed to create plan file: %v", err)
+                os.Exit(1)
+            }
+            defer file.Close()
+            out = file
+        }
+        if err := ui.WritePlan(out, recorder.Plan(), *planFormat); err != nil {
+            log.Error("Failed to write plan: %v", err)
+            os.Exit(1)
+        }
+        if *planOut != "" {
+            log.Info("Plan written to %s", *planOut)
+        }
+        return
+    }
+
     log.Info("Deployment completed successfully!")
-}
\ No newline at end of file
+}
+
+// addNotifiers registers the notification targets of the config with the
+// deployment service.
+func addNotifiers(deploymentService *usecase.DeploymentService, notifications domain.NotificationsConfig) error {
+    if len(notifications.Webhooks) > 0 {
+        webhooks, err := infrastructure.NewWebhookNotifier(notifications.Webhooks)
+        if err != nil {
+            return err
+        }
+        deploymentService.AddNotifier(webhooks)
+    }
+    if notifications.Email.Host != "" {
+        email, err := infrastructure.NewEmailNotifier(notifications.Email)
+        if err != nil {
+            return err
+        }
+        deploymentService.AddNotifier(email)
+    }
+    return nil
+}
+
+// setDeploymentLog makes the deployment service capture each deployment in
+// a log file, unless the config turns deployment logs off.
+func setDeploymentLog(deploymentService *usecase.DeploymentService, cfg *domain.Config, log *logger.Logger) {
+    if cfg.Logs.Disabled {
+        return
+    }
+    deploymentLog := infrastructure.NewDeploymentLog(cfg.Logs.Dir, infrastructure.ConfigSecrets(cfg))
+    log.SetTranscript(deploymentLog)
+    deploymentService.SetDeploymentLog(deploymentLog)
+}
+
+// logFlags are the logging flags shared by deployments and the subcommands.
+type logFlags struct {
+    format  *string
+    debug   *bool
+    noColor *bool
+}
+
+func addLogFlags(flags *flag.FlagSet) logFlags {
+    return logFlags{
+        format:  flags.String("log-format", "", "Log output format: text or json (default: DEPLOYER_LOG_FORMAT, then text)"),
+        debug:   flags.Bool("debug", false, "Log debug messages (also DEPLOYER_DEBUG=1)"),
+        noColor: flags.Bool("no-color", false, "Disable colors (also NO_COLOR=1; off when output is not a terminal)"),
+    }
+}
+
+// apply configures the logger with the parsed flags, which take precedence
+// over the environment.
+func (f logFlags) apply(log *logger.Logger) {
+    if *f.format != "" {
+        if err := log.SetFormat(*f.format); err != nil {
+            log.Error("%v", err)
+            os.Exit(1)
+        }
+    }
+    if *f.debug {
+        log.SetDebug(true)
+    }
+    if *f.noColor {
+        log.SetColor(false)
+    }
+}
+
+func envOr(key, fallback string) string {
+    if value := os.Getenv(key); value != "" {
+        return value
+    }
+    return fallback
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"deployer/internal/config"
+	"deployer/internal/domain"
+	"deployer/internal/infrastructure"
+	"deployer/internal/usecase"
+	"deployer/pkg/bytesize"
+	"deployer/pkg/logger"
+)
+
+// runPruneCommand implements "deployer prune", removing old images of the
+// services from the target server according to their retain_images policy.
+func runPruneCommand(args []string, log *logger.Logger) {
+	flags := flag.NewFlagSet("prune", flag.ExitOnError)
+	configFile := flags.String("config", "deployment.config.json", "Configuration file path")
+	service := flags.String("service", "", "Services to prune (comma-separated, default: all with retain_images)")
+	keep := flags.Int("keep", 0, "Number of recent images to keep, overriding retain_images")
+	dryRun := flags.Bool("dry-run", false, "List the images that would be removed without removing them")
+	logging := addLogFlags(flags)
+	flags.Parse(args)
+	logging.apply(log)
+
+	if *keep < 0 {
+		fmt.Println("Usage: deployer prune [-service <service-name>[,...]] [-keep <n>] [-dry-run] [-config deployment.config.json]")
+		os.Exit(1)
+	}
+
+	cfg, err := config.NewRepository().LoadConfig(*configFile)
+	if err != nil {
+		log.Error("Failed to load config: %v", err)
+		os.Exit(1)
+	}
+
+	var names []string
+	for _, name := range strings.Split(*service, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			if _, exists := cfg.Services[name]; !exists {
+				log.Error("Service '%s' not found in config", name)
+				os.Exit(1)
+			}
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		for name, serviceConfig := range cfg.Services {
+			if serviceConfig.RetainImages > 0 || *keep > 0 {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+	}
+	if len(names) == 0 {
+		fmt.Println("No service has retain_images set, pass -keep to prune anyway")
+		return
+	}
+
+	// The services run for real; -dry-run only skips removing the images.
+	sshService := infrastructure.NewSSHService(cfg.SSH, log, false)
+	sshService.SetSecrets(infrastructure.ConfigSecrets(cfg))
+	if err := sshService.Connect(cfg.SSH); err != nil {
+		log.Error("%v", err)
+		os.Exit(1)
+	}
+	var remoteDocker domain.RemoteDockerService = infrastructure.NewRemoteDockerCLI(sshService, log)
+	if cfg.Docker.RemoteClient == "api" {
+		remoteDocker = infrastructure.NewRemoteDockerAPI(sshService, cfg.Docker.RemoteSocket, log, false)
+	}
+	runStore := infrastructure.NewFileRunStore(filepath.Join(cfg.StateDir, "runs"))
+	deploymentService := usecase.NewDeploymentService(nil, remoteDocker, nil, sshService, nil, nil, runStore, nil, infrastructure.NewFieldLogger(log))
+
+	var total int64
+	failed := false
+	for _, name := range names {
+		retain := cfg.Services[name].RetainImages
+		if *keep > 0 {
+			retain = *keep
+		}
+		if retain <= 0 {
+			fmt.Printf("%s: no retain_images set, skipped\n", name)
+			continue
+		}
+
+		prune, err := deploymentService.PruneImages(name, retain, "", cfg, *dryRun)
+		if err != nil {
+			log.Error("%s: %v", name, err)
+			failed = true
+			continue
+		}
+
+		fmt.Printf("%s: %s (keeping %d)\n", name, prune.Repository, prune.Keep)
+		if len(prune.Removed) == 0 {
+			fmt.Println("  nothing to remove")
+		}
+		for _, image := range prune.Removed {
+			action := "removed"
+			if *dryRun {
+				action = "would remove"
+			}
+			fmt.Printf("  %-12s %-20s %s  %s\n", action, image.Tag, image.Created.Local().Format("2006-01-02 15:04"), bytesize.Format(image.Size))
+		}
+		total += prune.Reclaimed
+	}
+
+	if *dryRun {
+		fmt.Printf("Would reclaim %s\n", bytesize.Format(total))
+	} else {
+		fmt.Printf("Reclaimed %s\n", bytesize.Format(total))
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
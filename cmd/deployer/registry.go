@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"deployer/internal/config"
+	"deployer/internal/domain"
+	"deployer/internal/infrastructure"
+	"deployer/internal/usecase"
+	"deployer/pkg/logger"
+)
+
+// runRegistryCommand implements "deployer registry prune", deleting old tags
+// of a service's image from the registry.
+func runRegistryCommand(args []string, log *logger.Logger) {
+	usage := func() {
+		fmt.Println("Usage: deployer registry prune -service <service-name> [-keep 20] [-older-than 90d] [-grace 30d] [-force] [-dry-run] [-config deployment.config.json]")
+		os.Exit(1)
+	}
+	if len(args) == 0 || args[0] != "prune" {
+		usage()
+	}
+
+	flags := flag.NewFlagSet("registry prune", flag.ExitOnError)
+	configFile := flags.String("config", "deployment.config.json", "Configuration file path")
+	service := flags.String("service", "", "Service whose image tags to prune")
+	keep := flags.Int("keep", 20, "Number of most recent tags to keep")
+	olderThan := flags.String("older-than", "90d", "Only delete tags older than this (e.g. 90d, 12w, 36h)")
+	grace := flags.String("grace", "30d", "Keep tags deployed within this window, besides the current one")
+	force := flags.Bool("force", false, "Delete tags even if the run history has no deployment of the service")
+	dryRun := flags.Bool("dry-run", false, "List the tags that would be deleted without deleting them")
+	logging := addLogFlags(flags)
+	flags.Parse(args[1:])
+	logging.apply(log)
+
+	if *service == "" || *keep < 0 {
+		usage()
+	}
+	policy := domain.RegistryPrunePolicy{Keep: *keep, Force: *force}
+	var err error
+	if policy.OlderThan, err = parseAge(*olderThan); err != nil {
+		log.Error("-older-than: %v", err)
+		os.Exit(1)
+	}
+	if policy.Grace, err = parseAge(*grace); err != nil {
+		log.Error("-grace: %v", err)
+		os.Exit(1)
+	}
+
+	cfg, err := config.NewRepository().LoadConfig(*configFile)
+	if err != nil {
+		log.Error("Failed to load config: %v", err)
+		os.Exit(1)
+	}
+
+	// The image running on the server is protected, so the server must be
+	// reachable even for a dry run.
+	sshService := infrastructure.NewSSHService(cfg.SSH, log, false)
+	sshService.SetSecrets(infrastructure.ConfigSecrets(cfg))
+	if err := sshService.Connect(cfg.SSH); err != nil {
+		log.Error("%v", err)
+		os.Exit(1)
+	}
+	var remoteDocker domain.RemoteDockerService = infrastructure.NewRemoteDockerCLI(sshService, log)
+	if cfg.Docker.RemoteClient == "api" {
+		remoteDocker = infrastructure.NewRemoteDockerAPI(sshService, cfg.Docker.RemoteSocket, log, false)
+	}
+	registry := infrastructure.NewRegistryClient(cfg.Registry)
+	runStore := infrastructure.NewFileRunStore(filepath.Join(cfg.StateDir, "runs"))
+	deploymentService := usecase.NewDeploymentService(nil, remoteDocker, registry, sshService, nil, nil, runStore, nil, infrastructure.NewFieldLogger(log))
+
+	prune, err := deploymentService.PruneRegistry(*service, policy, cfg, *dryRun)
+	if err != nil {
+		log.Error("%v", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%s: %s (keeping %d, deleting tags older than %s)\n", prune.Service, prune.Repository, policy.Keep, *olderThan)
+	for _, tag := range prune.Protected {
+		fmt.Printf("  %-16s %-20s %s\n", "kept (deployed)", tag.Tag, tag.Created.Local().Format("2006-01-02"))
+	}
+	action := "deleted"
+	if *dryRun {
+		action = "would delete"
+	}
+	for _, tag := range prune.Deleted {
+		fmt.Printf("  %-16s %-20s %s\n", action, tag.Tag, tag.Created.Local().Format("2006-01-02"))
+	}
+	if len(prune.Deleted) == 0 {
+		fmt.Println("  nothing to delete")
+	} else if !*dryRun {
+		fmt.Println("Run the registry's garbage collection to free the storage.")
+	}
+}
+
+// parseAge parses a duration that may also be given in days or weeks, such
+// as 90d or 12w.
+func parseAge(value string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if number, found := strings.CutSuffix(value, suffix); found {
+			n, err := strconv.Atoi(number)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid duration '%s'", value)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("invalid duration '%s'", value)
+	}
+	return duration, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"deployer/internal/config"
+	"deployer/internal/infrastructure"
+	"deployer/internal/ui"
+	"deployer/pkg/logger"
+)
+
+// runTagsCommand implements "deployer tags -service <name>", listing the
+// versions of a service available in the registry, newest first.
+func runTagsCommand(args []string, log *logger.Logger) {
+	flags := flag.NewFlagSet("tags", flag.ExitOnError)
+	configFile := flags.String("config", "deployment.config.json", "Configuration file path")
+	service := flags.String("service", "", "Service whose image tags to list")
+	digests := flags.Bool("digests", false, "Also show the digest of each tag")
+	logging := addLogFlags(flags)
+	flags.Parse(args)
+	logging.apply(log)
+
+	if *service == "" {
+		fmt.Println("Usage: deployer tags -service <service-name> [-digests] [-config deployment.config.json]")
+		os.Exit(1)
+	}
+
+	cfg, err := config.NewRepository().LoadConfig(*configFile)
+	if err != nil {
+		log.Error("Failed to load config: %v", err)
+		os.Exit(1)
+	}
+	serviceConfig, exists := cfg.Services[*service]
+	if !exists {
+		log.Error("Service '%s' not found in config", *service)
+		os.Exit(1)
+	}
+
+	registry := infrastructure.NewRegistryClient(cfg.Registry)
+	tags, err := registry.ListTags(serviceConfig.ImageName)
+	if err != nil {
+		log.Error("%v", err)
+		os.Exit(1)
+	}
+	if len(tags) == 0 {
+		fmt.Printf("No tags of %s found in %s\n", serviceConfig.ImageName, cfg.Registry.Host)
+		return
+	}
+
+	ui.SortVersionsDescending(tags)
+	fmt.Printf("Tags of %s/%s:\n", cfg.Registry.Host, serviceConfig.ImageName)
+	for _, tag := range tags {
+		if !*digests {
+			fmt.Printf("  %s\n", tag)
+			continue
+		}
+		digest, err := registry.ResolveDigest(serviceConfig.ImageName, tag)
+		if err != nil {
+			digest = fmt.Sprintf("(%v)", err)
+		}
+		fmt.Printf("  %-20s %s\n", tag, digest)
+	}
+}
@@ -5,10 +5,36 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
 
 	"deployer/internal/domain"
 )
 
+// DefaultStateDir holds deployment run records when the config does not set
+// state_dir.
+const DefaultStateDir = ".deployer"
+
+// DefaultRemoteDockerSocket is the Docker Engine socket on the target server
+// forwarded over SSH when remote_client is "api".
+const DefaultRemoteDockerSocket = "/var/run/docker.sock"
+
+// DefaultHealthTimeout is how many seconds the verify step waits for a
+// container with a healthcheck to become healthy.
+const DefaultHealthTimeout = 60
+
+// DefaultMinFreeDiskMB is the free disk space, in megabytes, the preflight
+// checks require on the Docker data directory of the target server.
+const DefaultMinFreeDiskMB = 1024
+
+// Deployment lock defaults. The lock directory is relative to the home
+// directory of the SSH user on the target server.
+const (
+	DefaultLockScope = "service"
+	DefaultLockTTL   = 60
+	DefaultLockDir   = ".deployer/locks"
+)
+
 type Repository struct{}
 
 func NewRepository() *Repository {
@@ -34,13 +60,152 @@ func (r *Repository) LoadConfig(configFile string) (*domain.Config, error) {
 		config.SSH.Port = 22
 	}
 
+	if config.StateDir == "" {
+		config.StateDir = DefaultStateDir
+	}
+	if config.Logs.Dir == "" {
+		config.Logs.Dir = filepath.Join(config.StateDir, "logs")
+	}
+
+	if config.Lock.Scope == "" {
+		config.Lock.Scope = DefaultLockScope
+	}
+	if config.Lock.Scope != "service" && config.Lock.Scope != "host" {
+		return nil, fmt.Errorf("lock scope must be 'service' or 'host', got '%s'", config.Lock.Scope)
+	}
+	if config.Lock.TTLMinutes == 0 {
+		config.Lock.TTLMinutes = DefaultLockTTL
+	}
+	if config.Lock.Dir == "" {
+		config.Lock.Dir = DefaultLockDir
+	}
+
+	if config.Preflight.MinFreeDiskMB == 0 {
+		config.Preflight.MinFreeDiskMB = DefaultMinFreeDiskMB
+	}
+
+	if config.Docker.Client == "" {
+		config.Docker.Client = "cli"
+	}
+	if config.Docker.Client != "cli" && config.Docker.Client != "api" {
+		return nil, fmt.Errorf("docker client must be 'cli' or 'api', got '%s'", config.Docker.Client)
+	}
+	if config.Docker.RemoteClient == "" {
+		config.Docker.RemoteClient = "cli"
+	}
+	if config.Docker.RemoteClient != "cli" && config.Docker.RemoteClient != "api" {
+		return nil, fmt.Errorf("docker remote_client must be 'cli' or 'api', got '%s'", config.Docker.RemoteClient)
+	}
+	if config.Docker.RemoteSocket == "" {
+		config.Docker.RemoteSocket = DefaultRemoteDockerSocket
+	}
+
+	for i, webhook := range config.Notifications.Webhooks {
+		name := webhook.Name
+		if name == "" {
+			name = strconv.Itoa(i + 1)
+		}
+		if webhook.URL == "" {
+			return nil, fmt.Errorf("webhook %s: url is required", name)
+		}
+		if webhook.Format == "" {
+			config.Notifications.Webhooks[i].Format = "slack"
+		}
+		switch webhook.Format {
+		case "", "slack", "teams", "generic":
+		default:
+			return nil, fmt.Errorf("webhook %s: format must be 'slack', 'teams' or 'generic', got '%s'", name, webhook.Format)
+		}
+		if webhook.Body != "" && webhook.Format != "generic" {
+			return nil, fmt.Errorf("webhook %s: a body template needs format 'generic'", name)
+		}
+		if err := checkEvents(webhook.Events); err != nil {
+			return nil, fmt.Errorf("webhook %s: %w", name, err)
+		}
+	}
+
+	if email := &config.Notifications.Email; email.Host != "" || email.From != "" || len(email.To) > 0 || len(email.Recipients) > 0 {
+		if email.Host == "" || email.From == "" {
+			return nil, fmt.Errorf("email notifications need a 'host' and a 'from' address")
+		}
+		if email.TLS == "" {
+			email.TLS = "starttls"
+		}
+		switch email.TLS {
+		case "starttls":
+			if email.Port == 0 {
+				email.Port = 587
+			}
+		case "tls":
+			if email.Port == 0 {
+				email.Port = 465
+			}
+		case "none":
+			if email.Port == 0 {
+				email.Port = 25
+			}
+		default:
+			return nil, fmt.Errorf("email tls must be 'starttls', 'tls' or 'none', got '%s'", email.TLS)
+		}
+		if err := checkEvents(email.Events); err != nil {
+			return nil, fmt.Errorf("email: %w", err)
+		}
+	}
+
+	for name, service := range config.Services {
+		if service.ServiceName == "" {
+			service.ServiceName = name
+		}
+		if service.HealthTimeout <= 0 {
+			service.HealthTimeout = DefaultHealthTimeout
+		}
+		for _, secret := range service.Secrets {
+			if secret.ID == "" || (secret.Src == "") == (secret.Env == "") {
+				return nil, fmt.Errorf("service '%s': each build secret needs an 'id' and either 'src' or 'env'", name)
+			}
+		}
+		if service.Transfer == "ssh" && len(service.Platforms) > 0 {
+			return nil, fmt.Errorf("service '%s': platforms need the registry and cannot be used with transfer 'ssh'", name)
+		}
+		if service.Transfer != "" && service.Transfer != "registry" && service.Transfer != "ssh" {
+			return nil, fmt.Errorf("service '%s': transfer must be 'registry' or 'ssh', got '%s'", name, service.Transfer)
+		}
+		if service.RetainImages < 0 {
+			return nil, fmt.Errorf("service '%s': retain_images cannot be negative", name)
+		}
+		switch service.Versioning {
+		case "", "free", "semver", "calver":
+		default:
+			return nil, fmt.Errorf("service '%s': versioning must be 'free', 'semver' or 'calver', got '%s'", name, service.Versioning)
+		}
+		if service.Downgrade == "" {
+			service.Downgrade = "warn"
+		}
+		if service.Downgrade != "warn" && service.Downgrade != "block" {
+			return nil, fmt.Errorf("service '%s': downgrade must be 'warn' or 'block', got '%s'", name, service.Downgrade)
+		}
+		config.Services[name] = service
+	}
+
 	return &config, nil
 }
 
+// checkEvents checks the event filter of a notification target.
+func checkEvents(events []string) error {
+	for _, event := range events {
+		switch event {
+		case domain.EventStarted, domain.EventSucceeded, domain.EventFailed, domain.EventRolledBack:
+		default:
+			return fmt.Errorf("unknown event '%s', expected started, succeeded, failed or rolled_back", event)
+		}
+	}
+	return nil
+}
+
 func (r *Repository) GetServiceNames(config *domain.Config) []string {
 	names := make([]string, 0, len(config.Services))
 	for name := range config.Services {
 		names = append(names, name)
 	}
 	return names
-}
\ No newline at end of file
+}
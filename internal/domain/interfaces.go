@@ -1,21 +1,109 @@
 package domain
 
+import (
+	"io"
+	"net"
+	"time"
+)
+
 type ConfigRepository interface {
 	LoadConfig(configFile string) (*Config, error)
 	GetServiceNames(config *Config) []string
 }
 
 type DockerService interface {
-	BuildImage(imageName, version, buildPath string) error
+	Ping() error
+	BuildImage(options BuildOptions) error
 	TagImage(localImage, registryImage string) error
 	LoginRegistry(host, username, password string) error
 	PushImage(registryImage string) error
+	ImageDigest(registryImage string) (string, error)
+	InspectImage(image string) (*ImageInfo, error)
+	SaveImage(image string, w io.Writer) error
+}
+
+type RegistryService interface {
+	CheckCredentials() error
+	TagExists(repository, tag string) (bool, error)
+	ResolveDigest(repository, tag string) (string, error)
+	ListTags(repository string) ([]string, error)
+	InspectTag(repository, tag string) (*RegistryTag, error)
+	DeleteManifest(repository, digest string) error
 }
 
 type SSHService interface {
 	Connect(config SSHConfig) error
 	RunCommand(command string) error
 	RunCommandWithOutput(command string) (string, error)
+	RunCommandWithInput(command string, stdin io.Reader) (string, error)
+	RunCommandWithSecret(command, secret string) (string, error)
+	UploadFile(localPath, remotePath string) error
+	Dial(network, address string) (net.Conn, error)
+}
+
+type RemoteDockerService interface {
+	Ping() error
+	DiskFree() (int64, error)
+	HasNetwork(name string) (bool, error)
+	HasVolume(name string) (bool, error)
+	PublishedPorts() ([]PublishedPort, error)
+	Login(registry RegistryConfig) error
+	PullImage(image string) error
+	HasImage(id string) (bool, error)
+	TagImage(source, target string) error
+	LoadImage(r io.Reader) error
+	ListImages(repository string) ([]RemoteImage, error)
+	RemoveImage(reference string) error
+	InspectContainer(name string) (*ContainerState, error)
+	StopContainer(name string) error
+	RemoveContainer(name string) error
+	RunContainer(spec ContainerSpec) error
+	RunOnce(spec ContainerSpec) (string, error)
+	ContainerLogs(name string, tail int) (string, error)
+}
+
+type SourceControl interface {
+	Revision(dir string) (string, error)
+	Version(dir string) (string, error)
+	Dirty(dir string) (bool, error)
+}
+
+type ShellService interface {
+	RunLocal(command string, env map[string]string) error
+}
+
+type RunStore interface {
+	Save(run *DeploymentRun) error
+	Load(id string) (*DeploymentRun, error)
+	List() ([]*DeploymentRun, error)
+}
+
+type LockService interface {
+	Acquire(name, id string, ttl time.Duration) error
+	Release(name, id string) error
+	Refresh(name, id string, ttl time.Duration) error
+	List() ([]DeploymentLock, error)
+	ForceUnlock(name string) error
+}
+
+type Notifier interface {
+	Notify(event DeploymentEvent) error
+}
+
+type ProgressObserver interface {
+	Observe(event ProgressEvent)
+}
+
+// DeploymentLog captures the transcript of a deployment run.
+type DeploymentLog interface {
+	Start(runID string) (string, error)
+	Close() error
+}
+
+type PlanRecorder interface {
+	BeginStep(service, step string)
+	RecordLocal(dir string, env map[string]string, args []string)
+	RecordRemote(target, command, stdin string)
 }
 
 type DeploymentService interface {
@@ -23,8 +111,25 @@ type DeploymentService interface {
 }
 
 type Logger interface {
+	Debug(msg string, args ...interface{})
 	Info(msg string, args ...interface{})
 	Error(msg string, args ...interface{})
 	Warning(msg string, args ...interface{})
 	Success(msg string, args ...interface{})
-}
\ No newline at end of file
+}
+
+// FieldLogger is a Logger deriving child loggers that attach fields, such as
+// the service being deployed, to their entries.
+type FieldLogger interface {
+	Logger
+	With(fields map[string]string) FieldLogger
+}
+
+// Fields attached to log entries while a deployment runs.
+const (
+	LogService = "service"
+	LogVersion = "version"
+	LogHost    = "host"
+	LogStep    = "step"
+	LogRunID   = "run_id"
+)
@@ -1,19 +1,71 @@
 package domain
 
+import "time"
+
 type DeployConfig struct {
-	ServiceName   string `json:"service_name"`
-	ImageName     string `json:"image_name"`
-	Registry      string `json:"registry"`
-	BuildPath     string `json:"build_path"`
-	ContainerName string `json:"container_name"`
-	DockerRunArgs string `json:"docker_run_args"`
-	HealthTimeout int    `json:"health_timeout"`
+	ServiceName   string            `json:"service_name"`
+	ImageName     string            `json:"image_name"`
+	Registry      string            `json:"registry"`
+	BuildPath     string            `json:"build_path"`
+	ContainerName string            `json:"container_name"`
+	DockerRunArgs string            `json:"docker_run_args"`
+	HealthTimeout int               `json:"health_timeout"`
+	Transfer      string            `json:"transfer"`
+	Dockerfile    string            `json:"dockerfile"`
+	BuildArgs     map[string]string `json:"build_args"`
+	Target        string            `json:"target"`
+	Labels        map[string]string `json:"labels"`
+	NoCache       bool              `json:"no_cache"`
+	Pull          bool              `json:"pull"`
+	Secrets       []BuildSecret     `json:"secrets"`
+	Platforms     []string          `json:"platforms"`
+	CacheFrom     []string          `json:"cache_from"`
+	CacheTo       []string          `json:"cache_to"`
+	Versioning    string            `json:"versioning"`
+	Downgrade     string            `json:"downgrade"`
+	RetainImages  int               `json:"retain_images"`
+	DependsOn     []string          `json:"depends_on"`
+	Hooks         HooksConfig       `json:"hooks"`
+	Pipeline      []PipelineStep    `json:"pipeline"`
+}
+
+type BuildSecret struct {
+	ID  string `json:"id"`
+	Src string `json:"src"`
+	Env string `json:"env"`
+}
+
+type PipelineStep struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Command     string `json:"command"`
+	Remote      bool   `json:"remote"`
+	Args        string `json:"args"`
+	Once        bool   `json:"once"`
+	Seconds     int    `json:"seconds"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+}
+
+type HookConfig struct {
+	Command string `json:"command"`
+	Remote  bool   `json:"remote"`
+}
+
+type HooksConfig struct {
+	PreBuild  []HookConfig `json:"pre_build"`
+	PostPush  []HookConfig `json:"post_push"`
+	PreStop   []HookConfig `json:"pre_stop"`
+	PostStart []HookConfig `json:"post_start"`
+	OnFailure []HookConfig `json:"on_failure"`
+	OnSuccess []HookConfig `json:"on_success"`
 }
 
 type RegistryConfig struct {
 	Host     string `json:"host"`
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Insecure bool   `json:"insecure"`
 }
 
 type SSHConfig struct {
@@ -24,15 +76,295 @@ type SSHConfig struct {
 	KeyFile  string `json:"key_file"`
 }
 
+type DockerConfig struct {
+	Client       string `json:"client"`
+	Host         string `json:"host"`
+	RemoteClient string `json:"remote_client"`
+	RemoteSocket string `json:"remote_socket"`
+}
+
+type NotificationsConfig struct {
+	Webhooks []WebhookConfig `json:"webhooks"`
+	Email    EmailConfig     `json:"email"`
+}
+
+type WebhookConfig struct {
+	Name    string            `json:"name"`
+	URL     string            `json:"url"`
+	Format  string            `json:"format"`
+	Events  []string          `json:"events"`
+	Body    string            `json:"body"`
+	Headers map[string]string `json:"headers"`
+}
+
+type EmailConfig struct {
+	Host       string              `json:"host"`
+	Port       int                 `json:"port"`
+	TLS        string              `json:"tls"`
+	Username   string              `json:"username"`
+	Password   string              `json:"password"`
+	From       string              `json:"from"`
+	To         []string            `json:"to"`
+	Recipients map[string][]string `json:"recipients"`
+	Events     []string            `json:"events"`
+	Subject    string              `json:"subject"`
+	Body       string              `json:"body"`
+}
+
+type PreflightConfig struct {
+	Disabled      bool `json:"disabled"`
+	MinFreeDiskMB int  `json:"min_free_disk_mb"`
+}
+
+type LogsConfig struct {
+	Disabled bool   `json:"disabled"`
+	Dir      string `json:"dir"`
+}
+
+type LockConfig struct {
+	Disabled   bool   `json:"disabled"`
+	Scope      string `json:"scope"`
+	TTLMinutes int    `json:"ttl_minutes"`
+	Dir        string `json:"dir"`
+}
+
 type Config struct {
-	Registry RegistryConfig            `json:"registry"`
-	SSH      SSHConfig                 `json:"ssh"`
-	Services map[string]DeployConfig   `json:"services"`
+	Environment   string                  `json:"environment"`
+	Registry      RegistryConfig          `json:"registry"`
+	SSH           SSHConfig               `json:"ssh"`
+	Services      map[string]DeployConfig `json:"services"`
+	StateDir      string                  `json:"state_dir"`
+	Lock          LockConfig              `json:"lock"`
+	Docker        DockerConfig            `json:"docker"`
+	Preflight     PreflightConfig         `json:"preflight"`
+	Notifications NotificationsConfig     `json:"notifications"`
+	Logs          LogsConfig              `json:"logs"`
 }
 
 type DeploymentRequest struct {
 	ServiceName       string
-	Version          string
+	ServiceNames      []string
+	Version           string
 	BuildPathOverride string
-	DryRun           bool
-}
\ No newline at end of file
+	DryRun            bool
+	ResumeRunID       string
+	FromStep          string
+	SkipSteps         []string
+	Force             bool
+	AllowDirty        bool
+	AllowDowngrade    bool
+	Bump              string
+	Operator          string
+}
+
+const (
+	RunRunning   = "running"
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+
+	StepSucceeded = "succeeded"
+	StepFailed    = "failed"
+	StepSkipped   = "skipped"
+)
+
+// Deployment events sent to notification targets.
+const (
+	EventStarted    = "started"
+	EventSucceeded  = "succeeded"
+	EventFailed     = "failed"
+	EventRolledBack = "rolled_back"
+)
+
+type DeploymentEvent struct {
+	Type            string
+	RunID           string
+	Environment     string
+	Services        []string
+	Version         string
+	PreviousVersion string
+	Operator        string
+	Duration        time.Duration
+	FailedStep      string
+	Error           string
+	Time            time.Time
+}
+
+// Progress events published while a deployment runs.
+const (
+	ProgressStepStarted  = "step_started"
+	ProgressStepFinished = "step_finished"
+	ProgressStepFailed   = "step_failed"
+	ProgressLog          = "log"
+)
+
+// ProgressEvent reports a step of a deployment starting or ending, with the
+// share done of the steps run together for its service, or a message the
+// deployment logged.
+type ProgressEvent struct {
+	Type     string
+	RunID    string
+	Service  string
+	Step     string
+	Index    int
+	Total    int
+	Percent  int
+	Duration time.Duration
+	Error    string
+	Level    string
+	Message  string
+	Time     time.Time
+}
+
+type DeploymentRun struct {
+	ID          string       `json:"id"`
+	Version     string       `json:"version"`
+	Environment string       `json:"environment,omitempty"`
+	Host        string       `json:"host,omitempty"`
+	BuildPath   string       `json:"build_path,omitempty"`
+	Status      string       `json:"status"`
+	Error       string       `json:"error,omitempty"`
+	StartedAt   time.Time    `json:"started_at"`
+	FinishedAt  time.Time    `json:"finished_at,omitempty"`
+	Services    []ServiceRun `json:"services"`
+}
+
+type ServiceRun struct {
+	Name   string    `json:"name"`
+	Image  string    `json:"image,omitempty"`
+	Digest string    `json:"digest,omitempty"`
+	Steps  []StepRun `json:"steps"`
+}
+
+type StepRun struct {
+	Kind       string    `json:"kind"`
+	Name       string    `json:"name"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+type BuildOptions struct {
+	Image       string
+	Context     string
+	Dockerfile  string
+	BuildArgs   map[string]string
+	Target      string
+	Labels      map[string]string
+	NoCache     bool
+	Pull        bool
+	Secrets     []BuildSecret
+	Platforms   []string
+	Push        bool
+	CacheFrom   []string
+	CacheTo     []string
+	InlineCache bool
+}
+
+type ImageInfo struct {
+	ID       string
+	Size     int64
+	Platform string
+}
+
+type RemoteImage struct {
+	ID        string
+	Reference string
+	Tag       string
+	Created   time.Time
+	Size      int64
+}
+
+// ImagePrune lists the images of a service removed, or to be removed, from
+// the target server by the retention policy.
+type ImagePrune struct {
+	Service    string
+	Repository string
+	Keep       int
+	Removed    []RemoteImage
+	Reclaimed  int64
+}
+
+type RegistryTag struct {
+	Tag     string
+	Digest  string
+	Created time.Time
+}
+
+type RegistryPrunePolicy struct {
+	Keep      int
+	OlderThan time.Duration
+	Grace     time.Duration
+	// Force deletes tags even though no deployment of the service is known
+	// to the run history.
+	Force bool
+}
+
+// RegistryPrune lists the tags of a service deleted, or to be deleted, from
+// the registry, and those spared because they were recently deployed.
+type RegistryPrune struct {
+	Service    string
+	Repository string
+	Deleted    []RegistryTag
+	Protected  []RegistryTag
+}
+
+type ContainerSpec struct {
+	Name    string
+	Image   string
+	Args    string
+	Command string
+}
+
+type PublishedPort struct {
+	Container string
+	HostIP    string
+	HostPort  int
+	Protocol  string
+}
+
+type ContainerMount struct {
+	Source      string
+	Destination string
+}
+
+type ContainerState struct {
+	ID        string
+	Name      string
+	Image     string
+	ImageID   string
+	Status    string
+	Running   bool
+	Health    string
+	ExitCode  int
+	StartedAt time.Time
+	Mounts    []ContainerMount
+	Labels    map[string]string
+}
+
+type DeploymentLock struct {
+	Name      string    `json:"name"`
+	ID        string    `json:"id"`
+	Owner     string    `json:"owner"`
+	Machine   string    `json:"machine"`
+	PID       int       `json:"pid"`
+	StartedAt time.Time `json:"started_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type PlannedCommand struct {
+	Service string   `json:"service,omitempty"`
+	Step    string   `json:"step,omitempty"`
+	Target  string   `json:"target"`
+	Dir     string   `json:"dir,omitempty"`
+	Env     []string `json:"env,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	Command string   `json:"command,omitempty"`
+	Stdin   string   `json:"stdin,omitempty"`
+	Pipe    bool     `json:"pipe,omitempty"`
+}
+
+type Plan struct {
+	Secrets  []string         `json:"secrets,omitempty"`
+	Commands []PlannedCommand `json:"commands"`
+}
@@ -0,0 +1,118 @@
+package infrastructure
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"deployer/internal/domain"
+)
+
+// DeploymentLog implements domain.DeploymentLog. It is the io.Writer the
+// logger copies its transcript to: while a deployment runs, what is written
+// goes to <dir>/<run-id>.log with secret values masked, and is dropped
+// otherwise.
+type DeploymentLog struct {
+	dir     string
+	secrets []string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewDeploymentLog creates a deployment log writing under dir and masking
+// the given secret values. Empty values are ignored.
+func NewDeploymentLog(dir string, secrets []string) *DeploymentLog {
+	return &DeploymentLog{dir: dir, secrets: redactable(secrets)}
+}
+
+// redactable returns the non-empty secrets in the order redact replaces
+// them: longer secrets first, so that a secret containing another one is
+// not partially replaced.
+func redactable(secrets []string) []string {
+	var kept []string
+	for _, secret := range secrets {
+		if secret != "" {
+			kept = append(kept, secret)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool { return len(kept[i]) > len(kept[j]) })
+	return kept
+}
+
+// redact replaces the secrets, as returned by redactable, in text.
+func redact(text string, secrets []string) string {
+	for _, secret := range secrets {
+		text = strings.ReplaceAll(text, secret, "[REDACTED]")
+	}
+	return text
+}
+
+// Start opens the log of a run and returns its path.
+func (l *DeploymentLog) Start(runID string) (string, error) {
+	if err := os.MkdirAll(l.dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create log directory: %w", err)
+	}
+	path := filepath.Join(l.dir, runID+".log")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to open deployment log: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		l.file.Close()
+	}
+	l.file = file
+	return path, nil
+}
+
+func (l *DeploymentLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return len(p), nil
+	}
+
+	if _, err := l.file.WriteString(redact(string(p), l.secrets)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the log of the current run.
+func (l *DeploymentLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// ConfigSecrets returns the secret values of a config that must not appear
+// in logs: passwords, webhook URLs and headers, and the environment values
+// of build secrets.
+func ConfigSecrets(config *domain.Config) []string {
+	secrets := []string{config.Registry.Password, config.SSH.Password, config.Notifications.Email.Password}
+	for _, webhook := range config.Notifications.Webhooks {
+		secrets = append(secrets, webhook.URL)
+		for _, value := range webhook.Headers {
+			secrets = append(secrets, value)
+		}
+	}
+	for _, service := range config.Services {
+		for _, secret := range service.Secrets {
+			if secret.Env != "" {
+				secrets = append(secrets, os.Getenv(secret.Env))
+			}
+		}
+	}
+	return secrets
+}
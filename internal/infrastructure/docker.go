@@ -1,45 +1,96 @@
 package infrastructure
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	"deployer/internal/domain"
 )
 
 type DockerService struct {
-	logger domain.Logger
-	dryRun bool
+	logger   domain.Logger
+	dryRun   bool
+	recorder domain.PlanRecorder
+	stream   bool
 }
 
 func NewDockerService(logger domain.Logger, dryRun bool) *DockerService {
 	return &DockerService{
 		logger: logger,
 		dryRun: dryRun,
+		stream: true,
 	}
 }
 
-func (d *DockerService) BuildImage(imageName, version, buildPath string) error {
-	if buildPath == "" {
+// SetStreamOutput sets whether docker push writes its progress to the
+// terminal as it runs. When disabled, as with JSON logs, the output only goes
+// through the logger.
+func (d *DockerService) SetStreamOutput(enabled bool) {
+	d.stream = enabled
+}
+
+// SetRecorder makes the service record every docker command it would run
+// into a deployment plan.
+func (d *DockerService) SetRecorder(recorder domain.PlanRecorder) {
+	d.recorder = recorder
+}
+
+func (d *DockerService) record(cmd *exec.Cmd) {
+	if d.recorder != nil {
+		d.recorder.RecordLocal(cmd.Dir, nil, cmd.Args)
+	}
+}
+
+// Ping checks that the docker daemon answers.
+func (d *DockerService) Ping() error {
+	if d.dryRun {
+		return nil
+	}
+
+	output, err := exec.Command("docker", "version", "--format", "{{.Server.Version}}").CombinedOutput()
+	if err != nil {
+		if message := strings.TrimSpace(string(output)); message != "" {
+			return fmt.Errorf("docker daemon is not reachable: %s", message)
+		}
+		return fmt.Errorf("docker daemon is not reachable: %w", err)
+	}
+	return nil
+}
+
+func (d *DockerService) BuildImage(options domain.BuildOptions) error {
+	if options.Context == "" {
 		d.logger.Warning("No build path specified, skipping build step")
 		return nil
 	}
 
-	buildDir := buildPath
+	buildDir := options.Context
 	if !filepath.IsAbs(buildDir) {
 		wd, _ := os.Getwd()
 		buildDir = filepath.Join(wd, buildDir)
 	}
 
-	imageTag := fmt.Sprintf("%s:%s", imageName, version)
-	cmd := exec.Command("docker", "build", "-t", imageTag, ".")
+	cmd := exec.Command("docker", buildArgs(options)...)
 	cmd.Dir = buildDir
 
+	// Build secrets are a BuildKit feature.
+	var env map[string]string
+	if len(options.Secrets) > 0 {
+		env = map[string]string{"DOCKER_BUILDKIT": "1"}
+		cmd.Env = append(os.Environ(), "DOCKER_BUILDKIT=1")
+	}
+
 	d.logger.Info("Building in: %s", buildDir)
 	d.logger.Info("Command: %s", strings.Join(cmd.Args, " "))
+	if d.recorder != nil {
+		d.recorder.RecordLocal(cmd.Dir, env, cmd.Args)
+	}
 
 	if d.dryRun {
 		return nil
@@ -50,15 +101,105 @@ func (d *DockerService) BuildImage(imageName, version, buildPath string) error {
 		d.logger.Error("Build output: %s", output)
 		return fmt.Errorf("docker build failed: %w", err)
 	}
+	d.logger.Debug("Build output:\n%s", strings.TrimSpace(string(output)))
 
-	d.logger.Info("Image built: %s", imageTag)
+	if options.Push {
+		d.logger.Info("Image built and pushed for %s: %s", strings.Join(options.Platforms, ", "), options.Image)
+		return nil
+	}
+	d.logger.Info("Image built: %s", options.Image)
 	return nil
 }
 
+// buildArgs returns the docker build arguments for options, with build
+// arguments and labels in a stable order.
+func buildArgs(options domain.BuildOptions) []string {
+	buildx := needsBuildx(options)
+	args := []string{"build", "-t", options.Image}
+	if buildx {
+		args = []string{"buildx", "build", "-t", options.Image}
+	}
+	if len(options.Platforms) > 0 {
+		args = append(args, "--platform", strings.Join(options.Platforms, ","))
+	}
+	if options.Push {
+		args = append(args, "--push")
+	} else if buildx {
+		// Keep the image in the local image store like docker build does.
+		args = append(args, "--load")
+	}
+	if options.Dockerfile != "" {
+		args = append(args, "-f", options.Dockerfile)
+	}
+	for _, key := range sortedKeys(options.BuildArgs) {
+		args = append(args, "--build-arg", key+"="+options.BuildArgs[key])
+	}
+	if options.Target != "" {
+		args = append(args, "--target", options.Target)
+	}
+	for _, key := range sortedKeys(options.Labels) {
+		args = append(args, "--label", key+"="+options.Labels[key])
+	}
+	if options.NoCache {
+		args = append(args, "--no-cache")
+	}
+	for _, source := range options.CacheFrom {
+		args = append(args, "--cache-from", source)
+	}
+	for _, destination := range options.CacheTo {
+		args = append(args, "--cache-to", destination)
+	}
+	if options.InlineCache {
+		if !buildx {
+			args = append(args, "--build-arg", "BUILDKIT_INLINE_CACHE=1")
+		} else if len(options.CacheTo) == 0 {
+			args = append(args, "--cache-to", "type=inline")
+		}
+	}
+	if options.Pull {
+		args = append(args, "--pull")
+	}
+	for _, secret := range options.Secrets {
+		spec := "id=" + secret.ID
+		if secret.Src != "" {
+			spec += ",src=" + secret.Src
+		}
+		if secret.Env != "" {
+			spec += ",env=" + secret.Env
+		}
+		args = append(args, "--secret", spec)
+	}
+	return append(args, ".")
+}
+
+// needsBuildx reports whether options use features of buildx that docker
+// build lacks: multiple platforms, cache export and typed cache sources.
+func needsBuildx(options domain.BuildOptions) bool {
+	if len(options.Platforms) > 0 || len(options.CacheTo) > 0 {
+		return true
+	}
+	for _, source := range options.CacheFrom {
+		if strings.Contains(source, "type=") {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func (d *DockerService) TagImage(localImage, registryImage string) error {
 	cmd := exec.Command("docker", "tag", localImage, registryImage)
 
 	d.logger.Info("Command: %s", strings.Join(cmd.Args, " "))
+	d.record(cmd)
 
 	if d.dryRun {
 		return nil
@@ -77,6 +218,7 @@ func (d *DockerService) LoginRegistry(host, username, password string) error {
 	cmd := exec.Command("docker", "login", host, "-u", username, "-p", password)
 
 	d.logger.Info("Command: docker login %s -u %s -p [HIDDEN]", host, username)
+	d.record(cmd)
 
 	if d.dryRun {
 		return nil
@@ -95,18 +237,93 @@ func (d *DockerService) PushImage(registryImage string) error {
 	cmd := exec.Command("docker", "push", registryImage)
 
 	d.logger.Info("Command: %s", strings.Join(cmd.Args, " "))
+	d.record(cmd)
 
 	if d.dryRun {
 		return nil
 	}
 
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+	if d.stream {
+		cmd.Stdout = io.MultiWriter(os.Stdout, &output)
+		cmd.Stderr = io.MultiWriter(os.Stderr, &output)
+	}
 
-	if err := cmd.Run(); err != nil {
+	err := cmd.Run()
+	if err != nil {
+		if !d.stream {
+			d.logger.Error("Push output: %s", strings.TrimSpace(output.String()))
+		}
 		return fmt.Errorf("docker push failed: %w", err)
 	}
+	d.logger.Debug("Push output:\n%s", strings.TrimSpace(output.String()))
 
 	d.logger.Info("Pushed: %s", registryImage)
 	return nil
-}
\ No newline at end of file
+}
+func (d *DockerService) ImageDigest(registryImage string) (string, error) {
+	cmd := exec.Command("docker", "inspect", "--format", "{{join .RepoDigests \"\\n\"}}", registryImage)
+	d.record(cmd)
+
+	if d.dryRun {
+		return "", nil
+	}
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("docker inspect failed: %w", err)
+	}
+
+	repository, _ := splitImageTag(registryImage)
+
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if name, digest, found := strings.Cut(line, "@"); found && name == repository {
+			return digest, nil
+		}
+	}
+
+	return "", fmt.Errorf("no registry digest found for %s", registryImage)
+}
+
+func (d *DockerService) InspectImage(image string) (*domain.ImageInfo, error) {
+	cmd := exec.Command("docker", "image", "inspect", "--format", "{{.Id}} {{.Size}} {{.Os}}/{{.Architecture}}", image)
+	d.record(cmd)
+
+	if d.dryRun {
+		return &domain.ImageInfo{}, nil
+	}
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("docker image inspect failed: %w", err)
+	}
+
+	fields := strings.Fields(string(output))
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("unexpected docker image inspect output: %s", output)
+	}
+	info := &domain.ImageInfo{ID: fields[0], Platform: fields[2]}
+	info.Size, _ = strconv.ParseInt(fields[1], 10, 64)
+	return info, nil
+}
+
+func (d *DockerService) SaveImage(image string, w io.Writer) error {
+	cmd := exec.Command("docker", "save", image)
+
+	d.logger.Info("Command: %s", strings.Join(cmd.Args, " "))
+	d.record(cmd)
+
+	if d.dryRun {
+		return nil
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("docker save failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
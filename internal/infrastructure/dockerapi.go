@@ -0,0 +1,565 @@
+package infrastructure
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"deployer/internal/domain"
+)
+
+// DefaultDockerHost is the Docker Engine socket used when neither the config
+// nor DOCKER_HOST name one.
+const DefaultDockerHost = "unix:///var/run/docker.sock"
+
+// DockerAPIError is an error reported by the Docker Engine API, either as an
+// HTTP error response or as an error message in a progress stream.
+type DockerAPIError struct {
+	Operation  string
+	StatusCode int
+	Message    string
+}
+
+func (e *DockerAPIError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("docker %s failed (HTTP %d): %s", e.Operation, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("docker %s failed: %s", e.Operation, e.Message)
+}
+
+// DockerAPIService implements domain.DockerService by talking to the Docker
+// Engine HTTP API directly instead of running the docker CLI.
+type DockerAPIService struct {
+	engine *engine
+	logger domain.Logger
+	dryRun bool
+
+	mu      sync.Mutex
+	auth    map[string]string
+	digests map[string]string
+}
+
+// NewDockerAPIService connects to the engine at host, which is a unix:// or
+// tcp:// address. An empty host falls back to DOCKER_HOST and then to
+// DefaultDockerHost.
+func NewDockerAPIService(host string, logger domain.Logger, dryRun bool) (*DockerAPIService, error) {
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = DefaultDockerHost
+	}
+
+	engine, err := newEngine(host)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DockerAPIService{
+		engine:  engine,
+		logger:  logger,
+		dryRun:  dryRun,
+		auth:    make(map[string]string),
+		digests: make(map[string]string),
+	}, nil
+}
+
+// engine is a minimal Docker Engine API client.
+type engine struct {
+	client  *http.Client
+	baseURL string
+}
+
+// newEngine returns a client for a Docker Engine address.
+func newEngine(host string) (*engine, error) {
+	scheme, address, found := strings.Cut(host, "://")
+	if !found {
+		return nil, fmt.Errorf("invalid docker host '%s'", host)
+	}
+
+	switch scheme {
+	case "unix":
+		return newDialEngine(func(ctx context.Context) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", address)
+		}), nil
+	case "tcp", "http":
+		return &engine{client: &http.Client{}, baseURL: "http://" + address}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported docker host '%s', expected unix:// or tcp://", host)
+}
+
+// newDialEngine returns a client whose connections are opened by dial, such
+// as a unix socket or a socket forwarded over SSH.
+func newDialEngine(dial func(ctx context.Context) (net.Conn, error)) *engine {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dial(ctx)
+		},
+	}
+	return &engine{client: &http.Client{Transport: transport}, baseURL: "http://docker"}
+}
+
+func (d *DockerAPIService) Ping() error {
+	if d.dryRun {
+		return nil
+	}
+
+	resp, err := d.engine.request("ping", http.MethodGet, "/_ping", nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (d *DockerAPIService) BuildImage(options domain.BuildOptions) error {
+	if options.Context == "" {
+		d.logger.Warning("No build path specified, skipping build step")
+		return nil
+	}
+	if len(options.Secrets) > 0 {
+		return fmt.Errorf("build secrets need a BuildKit session, use the docker client \"cli\"")
+	}
+	if needsBuildx(options) {
+		return fmt.Errorf("multi-platform builds, cache_to and typed cache_from need buildx, use the docker client \"cli\"")
+	}
+
+	buildDir, err := filepath.Abs(options.Context)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"t": {options.Image}}
+	if options.Dockerfile != "" {
+		query.Set("dockerfile", filepath.ToSlash(options.Dockerfile))
+	}
+	buildArgs := make(map[string]string, len(options.BuildArgs)+1)
+	for key, value := range options.BuildArgs {
+		buildArgs[key] = value
+	}
+	if options.InlineCache {
+		buildArgs["BUILDKIT_INLINE_CACHE"] = "1"
+	}
+	if len(buildArgs) > 0 {
+		encoded, _ := json.Marshal(buildArgs)
+		query.Set("buildargs", string(encoded))
+	}
+	if len(options.CacheFrom) > 0 {
+		cacheFrom, _ := json.Marshal(options.CacheFrom)
+		query.Set("cachefrom", string(cacheFrom))
+	}
+	if options.Target != "" {
+		query.Set("target", options.Target)
+	}
+	if len(options.Labels) > 0 {
+		labels, _ := json.Marshal(options.Labels)
+		query.Set("labels", string(labels))
+	}
+	if options.NoCache {
+		query.Set("nocache", "1")
+	}
+	if options.Pull {
+		query.Set("pull", "1")
+	}
+
+	d.logger.Info("Building in: %s", buildDir)
+	d.logger.Info("Engine API: POST /build?t=%s", options.Image)
+
+	if d.dryRun {
+		return nil
+	}
+
+	// The context is streamed to the engine while it is archived rather
+	// than held in memory.
+	reader, writer := io.Pipe()
+	defer reader.Close()
+	sent := &countingWriter{w: writer}
+	contextErr := make(chan error, 1)
+	go func() {
+		err := buildContext(buildDir, sent)
+		writer.CloseWithError(err)
+		contextErr <- err
+	}()
+	// contextFailure returns the error archiving the context, once the
+	// request no longer reads it.
+	contextFailure := func() error {
+		reader.Close()
+		if err := <-contextErr; err != nil && !errors.Is(err, io.ErrClosedPipe) {
+			return fmt.Errorf("unable to create build context: %w", err)
+		}
+		return nil
+	}
+
+	resp, err := d.engine.request("build", http.MethodPost, "/build?"+query.Encode(), reader, map[string]string{"Content-Type": "application/x-tar"})
+	if err != nil {
+		if contextErr := contextFailure(); contextErr != nil {
+			return contextErr
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = readStream("build", resp.Body, func(msg streamMessage) {
+		if line := strings.TrimRight(msg.Stream, "\n"); strings.TrimSpace(line) != "" {
+			d.logger.Info("%s", line)
+		}
+	})
+	if contextErr := contextFailure(); contextErr != nil {
+		return contextErr
+	}
+	if err != nil {
+		return err
+	}
+	d.logger.Debug("Build context: %d bytes", sent.n)
+
+	d.logger.Info("Image built: %s", options.Image)
+	return nil
+}
+
+func (d *DockerAPIService) TagImage(localImage, registryImage string) error {
+	repository, tag := splitImageTag(registryImage)
+	d.logger.Info("Engine API: POST /images/%s/tag?repo=%s&tag=%s", localImage, repository, tag)
+
+	if d.dryRun {
+		return nil
+	}
+
+	query := url.Values{"repo": {repository}, "tag": {tag}}
+	resp, err := d.engine.request("tag", http.MethodPost, "/images/"+localImage+"/tag?"+query.Encode(), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	d.logger.Info("Tagged: %s -> %s", localImage, registryImage)
+	return nil
+}
+
+func (d *DockerAPIService) LoginRegistry(host, username, password string) error {
+	d.logger.Info("Engine API: POST /auth (%s as %s)", host, username)
+
+	credentials := map[string]string{
+		"username":      username,
+		"password":      password,
+		"serveraddress": host,
+	}
+	data, err := json.Marshal(credentials)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.auth[host] = base64.URLEncoding.EncodeToString(data)
+	d.mu.Unlock()
+
+	if d.dryRun {
+		return nil
+	}
+
+	resp, err := d.engine.request("login", http.MethodPost, "/auth", bytes.NewReader(data), map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	d.logger.Info("Logged into registry: %s", host)
+	return nil
+}
+
+func (d *DockerAPIService) PushImage(registryImage string) error {
+	repository, tag := splitImageTag(registryImage)
+	d.logger.Info("Engine API: POST /images/%s/push?tag=%s", repository, tag)
+
+	if d.dryRun {
+		return nil
+	}
+
+	// The engine requires the header even for registries without
+	// authentication.
+	d.mu.Lock()
+	auth, found := d.auth[registryHost(repository)]
+	d.mu.Unlock()
+	if !found {
+		auth = base64.URLEncoding.EncodeToString([]byte("{}"))
+	}
+
+	query := url.Values{"tag": {tag}}
+	resp, err := d.engine.request("push", http.MethodPost, "/images/"+repository+"/push?"+query.Encode(), nil, map[string]string{"X-Registry-Auth": auth})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	layers := make(map[string]string)
+	err = readStream("push", resp.Body, func(msg streamMessage) {
+		if msg.Aux.Digest != "" {
+			d.mu.Lock()
+			d.digests[registryImage] = msg.Aux.Digest
+			d.mu.Unlock()
+		}
+		if msg.ID == "" || msg.Status == "" || layers[msg.ID] == msg.Status {
+			return
+		}
+		layers[msg.ID] = msg.Status
+		if msg.ProgressDetail.Total > 0 {
+			d.logger.Info("Layer %s: %s (%d%%)", msg.ID, msg.Status, msg.ProgressDetail.Current*100/msg.ProgressDetail.Total)
+		} else {
+			d.logger.Info("Layer %s: %s", msg.ID, msg.Status)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	d.logger.Info("Pushed: %s", registryImage)
+	return nil
+}
+
+func (d *DockerAPIService) ImageDigest(registryImage string) (string, error) {
+	if d.dryRun {
+		return "", nil
+	}
+
+	d.mu.Lock()
+	digest, found := d.digests[registryImage]
+	d.mu.Unlock()
+	if found {
+		return digest, nil
+	}
+
+	resp, err := d.engine.request("inspect", http.MethodGet, "/images/"+registryImage+"/json", nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var image struct {
+		RepoDigests []string
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&image); err != nil {
+		return "", fmt.Errorf("invalid inspect response: %w", err)
+	}
+
+	repository, _ := splitImageTag(registryImage)
+	for _, repoDigest := range image.RepoDigests {
+		if name, digest, found := strings.Cut(repoDigest, "@"); found && name == repository {
+			return digest, nil
+		}
+	}
+
+	return "", fmt.Errorf("no registry digest found for %s", registryImage)
+}
+
+func (d *DockerAPIService) InspectImage(image string) (*domain.ImageInfo, error) {
+	if d.dryRun {
+		return &domain.ImageInfo{}, nil
+	}
+
+	resp, err := d.engine.request("inspect", http.MethodGet, "/images/"+image+"/json", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var inspected struct {
+		ID           string `json:"Id"`
+		Size         int64  `json:"Size"`
+		Os           string `json:"Os"`
+		Architecture string `json:"Architecture"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&inspected); err != nil {
+		return nil, fmt.Errorf("invalid inspect response: %w", err)
+	}
+	return &domain.ImageInfo{
+		ID:       inspected.ID,
+		Size:     inspected.Size,
+		Platform: inspected.Os + "/" + inspected.Architecture,
+	}, nil
+}
+
+func (d *DockerAPIService) SaveImage(image string, w io.Writer) error {
+	d.logger.Info("Engine API: GET /images/%s/get", image)
+
+	if d.dryRun {
+		return nil
+	}
+
+	resp, err := d.engine.request("save", http.MethodGet, "/images/"+image+"/get", nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("docker save failed: %w", err)
+	}
+	return nil
+}
+
+// request performs an API call and turns error responses into a
+// DockerAPIError. The caller must close the body of the returned response.
+func (e *engine) request(operation, method, path string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(method, e.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker engine unreachable: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(data, &apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		return nil, &DockerAPIError{Operation: operation, StatusCode: resp.StatusCode, Message: apiErr.Message}
+	}
+
+	return resp, nil
+}
+
+// streamMessage is one line of the JSON progress stream returned by build
+// and push.
+type streamMessage struct {
+	Stream         string `json:"stream"`
+	Status         string `json:"status"`
+	ID             string `json:"id"`
+	Error          string `json:"error"`
+	ProgressDetail struct {
+		Current int64 `json:"current"`
+		Total   int64 `json:"total"`
+	} `json:"progressDetail"`
+	Aux struct {
+		Digest string `json:"Digest"`
+	} `json:"aux"`
+}
+
+func readStream(operation string, r io.Reader, handle func(streamMessage)) error {
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var msg streamMessage
+		if err := decoder.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("invalid %s progress stream: %w", operation, err)
+		}
+		if msg.Error != "" {
+			return &DockerAPIError{Operation: operation, Message: msg.Error}
+		}
+		handle(msg)
+	}
+}
+
+// buildContext writes dir to w as a tar build context, leaving out files
+// excluded by its .dockerignore. An excluded directory is only walked when a
+// "!" pattern may re-include files below it, and then gets no entry of its
+// own.
+func buildContext(dir string, w io.Writer) error {
+	ignore, err := readDockerignore(filepath.Join(dir, ".dockerignore"))
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if rel != "Dockerfile" && rel != ".dockerignore" && ignore.excludes(rel) {
+			if info.IsDir() && !ignore.mayReinclude(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// splitImageTag splits "host/name:tag" into repository and tag.
+func splitImageTag(image string) (string, string) {
+	// A digest reference keeps the digest in place of the tag.
+	if i := strings.Index(image, "@"); i >= 0 {
+		return image[:i], image[i+1:]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:]
+	}
+	return image, "latest"
+}
+
+// registryHost returns the registry part of a repository name.
+func registryHost(repository string) string {
+	host, _, _ := strings.Cut(repository, "/")
+	return host
+}
@@ -0,0 +1,74 @@
+package infrastructure
+
+import (
+	"archive/tar"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"deployer/internal/domain"
+	"deployer/pkg/logger"
+)
+
+func TestDockerAPIBuildStreamsContext(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var archived []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/build" || r.URL.Query().Get("t") != "app:1.0.0" {
+			t.Errorf("request = %s %s, want POST /build?t=app:1.0.0", r.Method, r.URL)
+		}
+		if r.ContentLength != -1 {
+			t.Errorf("Content-Length = %d, want a streamed body", r.ContentLength)
+		}
+		reader := tar.NewReader(r.Body)
+		for {
+			header, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Errorf("invalid build context: %v", err)
+				break
+			}
+			archived = append(archived, header.Name)
+		}
+		io.WriteString(w, `{"stream":"Step 1/1 : FROM scratch\n"}`)
+	}))
+	defer server.Close()
+
+	docker, err := NewDockerAPIService("tcp://"+strings.TrimPrefix(server.URL, "http://"), logger.New("test"), false)
+	if err != nil {
+		t.Fatalf("NewDockerAPIService: %v", err)
+	}
+	if err := docker.BuildImage(domain.BuildOptions{Image: "app:1.0.0", Context: dir}); err != nil {
+		t.Fatalf("BuildImage: %v", err)
+	}
+	if strings.Join(archived, " ") != "Dockerfile" {
+		t.Errorf("build context = %v, want the Dockerfile", archived)
+	}
+}
+
+func TestDockerAPIBuildEngineError(t *testing.T) {
+	dir := t.TempDir()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"no space left on device"}`, http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	docker, err := NewDockerAPIService("tcp://"+strings.TrimPrefix(server.URL, "http://"), logger.New("test"), false)
+	if err != nil {
+		t.Fatalf("NewDockerAPIService: %v", err)
+	}
+	err = docker.BuildImage(domain.BuildOptions{Image: "app:1.0.0", Context: dir})
+	if err == nil || !strings.Contains(err.Error(), "no space left on device") {
+		t.Errorf("BuildImage error = %v, want the engine error", err)
+	}
+}
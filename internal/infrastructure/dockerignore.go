@@ -0,0 +1,151 @@
+package infrastructure
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// dockerignore holds the patterns of a .dockerignore file, matched the way
+// the Docker CLI matches them: "*" and "?" stay within a path element, "**"
+// spans any number of them, a pattern matching a directory excludes
+// everything below it, and the last matching pattern wins, so that "!"
+// patterns re-include what earlier ones excluded.
+type dockerignore struct {
+	patterns   []ignorePattern
+	exclusions bool
+}
+
+type ignorePattern struct {
+	text      string
+	exclusion bool
+	dirs      int
+	re        *regexp.Regexp
+}
+
+func readDockerignore(file string) (*dockerignore, error) {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return &dockerignore{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseDockerignore(string(data))
+}
+
+func parseDockerignore(data string) (*dockerignore, error) {
+	ignore := &dockerignore{}
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		exclusion := strings.HasPrefix(line, "!")
+		if exclusion {
+			line = strings.TrimSpace(line[1:])
+			if line == "" {
+				return nil, fmt.Errorf("invalid .dockerignore pattern '!'")
+			}
+		}
+		text := path.Clean(strings.ReplaceAll(line, "\\", "/"))
+		if len(text) > 1 && text[0] == '/' {
+			text = text[1:]
+		}
+
+		re, err := regexp.Compile(ignoreRegexp(text))
+		if err != nil {
+			return nil, fmt.Errorf("invalid .dockerignore pattern '%s': %w", line, err)
+		}
+		ignore.patterns = append(ignore.patterns, ignorePattern{
+			text:      text,
+			exclusion: exclusion,
+			dirs:      len(strings.Split(text, "/")),
+			re:        re,
+		})
+		ignore.exclusions = ignore.exclusions || exclusion
+	}
+	return ignore, nil
+}
+
+// ignoreRegexp translates a cleaned .dockerignore pattern into an anchored
+// regular expression.
+func ignoreRegexp(pattern string) string {
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; ch {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+				}
+				if i+1 == len(pattern) {
+					re.WriteString(".*")
+				} else {
+					re.WriteString("(.*/)?")
+				}
+			} else {
+				re.WriteString("[^/]*")
+			}
+		case '?':
+			re.WriteString("[^/]")
+		case '[', ']':
+			re.WriteByte(ch)
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				re.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			} else {
+				re.WriteString(`\\`)
+			}
+		default:
+			re.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	re.WriteString("$")
+	return re.String()
+}
+
+// excludes reports whether the slash-separated path rel, relative to the
+// build context, is left out of the context.
+func (i *dockerignore) excludes(rel string) bool {
+	var parents []string
+	if parent := path.Dir(rel); parent != "." {
+		parents = strings.Split(parent, "/")
+	}
+
+	excluded := false
+	for _, pattern := range i.patterns {
+		// Only a later pattern of the other kind can change the outcome.
+		if pattern.exclusion != excluded {
+			continue
+		}
+		match := pattern.re.MatchString(rel)
+		if !match && pattern.dirs <= len(parents) {
+			match = pattern.re.MatchString(strings.Join(parents[:pattern.dirs], "/"))
+		}
+		if match {
+			excluded = !pattern.exclusion
+		}
+	}
+	return excluded
+}
+
+// mayReinclude reports whether an excluded directory must still be walked
+// because a "!" pattern could re-include something below it.
+func (i *dockerignore) mayReinclude(dir string) bool {
+	if !i.exclusions {
+		return false
+	}
+	for _, pattern := range i.patterns {
+		if pattern.exclusion && strings.HasPrefix(pattern.text+"/", dir+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package infrastructure
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestDockerignoreExcludes(t *testing.T) {
+	ignore, err := parseDockerignore(`
+# comment
+node_modules
+/build
+*.log
+**/*.tmp
+docs/**/draft.md
+vendor
+!vendor/keep
+logs
+!logs/important.log
+`)
+	if err != nil {
+		t.Fatalf("parseDockerignore: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "node_modules", want: true},
+		{path: "node_modules/pkg/index.js", want: true},
+		{path: "src/node_modules", want: false},
+		{path: "build/app", want: true},
+		{path: "app.log", want: true},
+		{path: "src/app.log", want: false},
+		{path: "a.tmp", want: true},
+		{path: "src/deep/a.tmp", want: true},
+		{path: "docs/draft.md", want: true},
+		{path: "docs/guide/v1/draft.md", want: true},
+		{path: "docs/guide/final.md", want: false},
+		{path: "vendor/lib.go", want: true},
+		{path: "vendor/keep", want: false},
+		{path: "vendor/keep/file.go", want: false},
+		{path: "logs/debug.log", want: true},
+		{path: "logs/important.log", want: false},
+		{path: "main.go", want: false},
+	}
+	for _, test := range tests {
+		if got := ignore.excludes(test.path); got != test.want {
+			t.Errorf("excludes(%s) = %v, want %v", test.path, got, test.want)
+		}
+	}
+}
+
+func TestDockerignoreInvalidPattern(t *testing.T) {
+	if _, err := parseDockerignore("!\n"); err == nil {
+		t.Error("parseDockerignore(\"!\") succeeded, want an error")
+	}
+}
+
+func TestBuildContextReincludes(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		".dockerignore":        "vendor\n!vendor/keep\nsecrets\n",
+		"Dockerfile":           "FROM scratch\n",
+		"main.go":              "package main\n",
+		"vendor/lib.go":        "package lib\n",
+		"vendor/keep/keep.go":  "package keep\n",
+		"secrets/key.pem":      "secret\n",
+		"src/vendor/inner.txt": "kept\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var archive bytes.Buffer
+	if err := buildContext(dir, &archive); err != nil {
+		t.Fatalf("buildContext: %v", err)
+	}
+
+	var names []string
+	reader := tar.NewReader(&archive)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid archive: %v", err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			names = append(names, header.Name)
+		}
+	}
+	sort.Strings(names)
+
+	want := []string{".dockerignore", "Dockerfile", "main.go", "src/vendor/inner.txt", "vendor/keep/keep.go"}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Errorf("archived files = %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,221 @@
+package infrastructure
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"deployer/internal/domain"
+)
+
+// Email transport security modes.
+const (
+	EmailSTARTTLS = "starttls"
+	EmailTLS      = "tls"
+	EmailNoTLS    = "none"
+)
+
+const defaultEmailSubject = `[deployer{{if .Environment}} {{.Environment}}{{end}}] {{.Summary}}`
+
+const defaultEmailBody = `{{.Summary}}.
+
+{{if .PreviousVersion}}Change:       {{.PreviousVersion}} → {{.Version}}
+{{else}}Version:      {{.Version}}
+{{end}}Services:     {{join .Services ", "}}
+{{if .Environment}}Environment:  {{.Environment}}
+{{end}}Operator:     {{.Operator}}
+{{if ne .Type "started"}}Duration:     {{.Duration}}
+{{end}}{{if .FailedStep}}Failed step:  {{.FailedStep}}
+{{end}}{{if .Error}}Error:        {{.Error}}
+{{end}}Run:          {{.RunID}}
+Time:         {{.Time.Format "2006-01-02 15:04:05 MST"}}
+`
+
+// EmailNotifier implements domain.Notifier by sending deployment events by
+// email over SMTP to the recipients of the deployment's environment.
+type EmailNotifier struct {
+	config  domain.EmailConfig
+	from    *mail.Address
+	subject *template.Template
+	body    *template.Template
+}
+
+// emailData is what the subject and body templates are rendered with: the
+// event fields and its one-line Summary.
+type emailData struct {
+	domain.DeploymentEvent
+	Summary string
+}
+
+// NewEmailNotifier returns a notifier sending through the configured SMTP
+// server, failing on an invalid address or template.
+func NewEmailNotifier(config domain.EmailConfig) (*EmailNotifier, error) {
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return nil, fmt.Errorf("email: invalid from address '%s': %w", config.From, err)
+	}
+	for _, to := range allRecipients(config) {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return nil, fmt.Errorf("email: invalid recipient '%s': %w", to, err)
+		}
+	}
+
+	subject, body := config.Subject, config.Body
+	if subject == "" {
+		subject = defaultEmailSubject
+	}
+	if body == "" {
+		body = defaultEmailBody
+	}
+	n := &EmailNotifier{config: config, from: from}
+	if n.subject, err = template.New("subject").Funcs(templateFuncs).Parse(subject); err != nil {
+		return nil, fmt.Errorf("email: invalid subject template: %w", err)
+	}
+	if n.body, err = template.New("body").Funcs(templateFuncs).Parse(body); err != nil {
+		return nil, fmt.Errorf("email: invalid body template: %w", err)
+	}
+	return n, nil
+}
+
+// Notify emails the event to the recipients of its environment, or to the
+// default recipients, if it is one of the configured events.
+func (n *EmailNotifier) Notify(event domain.DeploymentEvent) error {
+	if !subscribed(n.config.Events, event.Type) {
+		return nil
+	}
+	to, ok := n.config.Recipients[event.Environment]
+	if !ok {
+		to = n.config.To
+	}
+	if len(to) == 0 {
+		return nil
+	}
+
+	data := emailData{DeploymentEvent: event, Summary: eventSummary(event)}
+	var subject, body bytes.Buffer
+	if err := n.subject.Execute(&subject, data); err != nil {
+		return fmt.Errorf("email: subject template failed: %w", err)
+	}
+	if err := n.body.Execute(&body, data); err != nil {
+		return fmt.Errorf("email: body template failed: %w", err)
+	}
+
+	message, err := n.message(to, strings.TrimSpace(subject.String()), body.String(), event.Time)
+	if err != nil {
+		return fmt.Errorf("email: %w", err)
+	}
+	if err := n.send(to, message); err != nil {
+		return fmt.Errorf("email via %s: %w", n.config.Host, err)
+	}
+	return nil
+}
+
+// message builds a plain text message, quoted-printable encoded so that
+// any character of the templates survives the transfer.
+func (n *EmailNotifier) message(to []string, subject, body string, date time.Time) ([]byte, error) {
+	var message bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&message, "%s: %s\r\n", name, value)
+	}
+	header("From", n.from.String())
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	message.WriteString("\r\n")
+
+	w := quotedprintable.NewWriter(&message)
+	if _, err := w.Write([]byte(body)); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return message.Bytes(), nil
+}
+
+func (n *EmailNotifier) send(to []string, message []byte) error {
+	host := n.config.Host
+	addr := net.JoinHostPort(host, strconv.Itoa(n.config.Port))
+	tlsConfig := &tls.Config{ServerName: host}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+
+	var conn net.Conn
+	var err error
+	if n.config.TLS == EmailTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if hostname, err := os.Hostname(); err == nil {
+		if err := client.Hello(hostname); err != nil {
+			return err
+		}
+	}
+	if n.config.TLS == EmailSTARTTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+	if n.config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.config.Username, n.config.Password, host)); err != nil {
+			return fmt.Errorf("authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(n.from.Address); err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		address, _ := mail.ParseAddress(recipient)
+		if err := client.Rcpt(address.Address); err != nil {
+			return fmt.Errorf("recipient %s: %w", recipient, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func allRecipients(config domain.EmailConfig) []string {
+	recipients := append([]string(nil), config.To...)
+	for _, to := range config.Recipients {
+		recipients = append(recipients, to...)
+	}
+	return recipients
+}
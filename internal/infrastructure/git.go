@@ -0,0 +1,150 @@
+package infrastructure
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// GitService reads revision information from the git checkout containing a
+// build directory.
+type GitService struct {
+	ignored []string
+}
+
+// NewGitService returns a git service that does not count changes under the
+// given directories, such as the deployer's own run records and logs, as
+// uncommitted changes.
+func NewGitService(ignored ...string) *GitService {
+	return &GitService{ignored: ignored}
+}
+
+// Revision returns the commit SHA checked out in dir, or an empty string when
+// dir is not inside a git repository or git is not installed.
+func (g *GitService) Revision(dir string) (string, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return "", nil
+	}
+
+	output, err := g.git(dir, "rev-parse", "HEAD")
+	if err != nil {
+		if strings.Contains(output, "not a git repository") {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// Version derives an image version from the checkout in dir: the tag on
+// HEAD, else `git describe --tags`, else the short commit SHA, with a
+// "-dirty" suffix when there are uncommitted changes. A leading "v" of a tag
+// such as v1.4.0 is dropped. It returns an empty string when dir is not
+// inside a git repository.
+func (g *GitService) Version(dir string) (string, error) {
+	revision, err := g.Revision(dir)
+	if err != nil || revision == "" {
+		return "", err
+	}
+
+	version, err := g.git(dir, "describe", "--tags", "--exact-match", "HEAD")
+	if err != nil {
+		version, err = g.git(dir, "describe", "--tags")
+	}
+	if err != nil {
+		version, err = g.git(dir, "rev-parse", "--short", "HEAD")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	version = sanitizeTag(strings.TrimSpace(version))
+	if len(version) > 1 && version[0] == 'v' && version[1] >= '0' && version[1] <= '9' {
+		version = version[1:]
+	}
+
+	dirty, err := g.Dirty(dir)
+	if err != nil {
+		return "", err
+	}
+	if dirty {
+		version += "-dirty"
+	}
+	return version, nil
+}
+
+// Dirty reports whether the checkout in dir has uncommitted changes.
+func (g *GitService) Dirty(dir string) (bool, error) {
+	revision, err := g.Revision(dir)
+	if err != nil || revision == "" {
+		return false, err
+	}
+
+	output, err := g.git(dir, "status", "--porcelain", "-z", "--untracked-files=all")
+	if err != nil {
+		return false, err
+	}
+	if len(g.ignored) == 0 {
+		return output != "", nil
+	}
+
+	top, err := g.git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return false, err
+	}
+	top = strings.TrimSpace(top)
+
+	// Entries are "XY path", with the original path of a rename or copy in
+	// the next entry. Paths are relative to the top of the checkout.
+	entries := strings.Split(output, "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		if entry[0] == 'R' || entry[0] == 'C' {
+			i++
+		}
+		if !g.isIgnored(filepath.Join(top, filepath.FromSlash(entry[3:]))) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (g *GitService) isIgnored(path string) bool {
+	for _, dir := range g.ignored {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			continue
+		}
+		if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+			abs = resolved
+		}
+		if rel, err := filepath.Rel(abs, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeTag replaces the characters Docker does not allow in a tag.
+func sanitizeTag(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+			return r
+		}
+		return '-'
+	}, s)
+}
+
+func (g *GitService) git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("git %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
@@ -0,0 +1,246 @@
+package infrastructure
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"deployer/internal/domain"
+	"deployer/pkg/shellwords"
+)
+
+var unsafeLockChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// RemoteLockService keeps deployment locks as directories on the target
+// server, relying on mkdir being atomic. Each lock directory holds an info
+// file describing its owner. Taking over an expired lock, refreshing and
+// releasing a lock all happen while holding a guard directory next to it, so
+// they cannot interleave.
+type RemoteLockService struct {
+	ssh    domain.SSHService
+	dir    string
+	logger domain.Logger
+	dryRun bool
+
+	mu   sync.Mutex
+	held map[string]domain.DeploymentLock
+}
+
+func NewRemoteLockService(ssh domain.SSHService, dir string, logger domain.Logger, dryRun bool) *RemoteLockService {
+	return &RemoteLockService{
+		ssh:    ssh,
+		dir:    dir,
+		logger: logger,
+		dryRun: dryRun,
+		held:   make(map[string]domain.DeploymentLock),
+	}
+}
+
+func (l *RemoteLockService) Acquire(name, id string, ttl time.Duration) error {
+	if l.dryRun {
+		l.logger.Info("Dry run: not acquiring deployment lock '%s'", name)
+		return nil
+	}
+
+	lock := domain.DeploymentLock{
+		Name:      name,
+		ID:        id,
+		Owner:     CurrentUser(),
+		PID:       os.Getpid(),
+		StartedAt: time.Now().UTC(),
+		ExpiresAt: time.Now().UTC().Add(ttl),
+	}
+	lock.Machine, _ = os.Hostname()
+
+	data, err := json.Marshal(lock)
+	if err != nil {
+		return err
+	}
+	info := shellwords.Quote(string(data))
+
+	lockDir := l.lockDir(name)
+	cmd := fmt.Sprintf("mkdir -p %s && if mkdir %s 2>/dev/null; then printf %%s %s > %s/info && echo ACQUIRED; else cat %s/info 2>/dev/null; fi",
+		shellwords.Quote(l.dir), lockDir, info, lockDir, lockDir)
+	output, err := l.ssh.RunCommandWithOutput(cmd)
+	if err != nil {
+		return fmt.Errorf("unable to acquire deployment lock '%s': %w", name, err)
+	}
+	if strings.TrimSpace(output) == "ACQUIRED" {
+		l.logger.Info("Acquired deployment lock '%s'", name)
+		l.hold(lock)
+		return nil
+	}
+
+	holder, err := parseLock(output)
+	if err != nil {
+		return fmt.Errorf("deployment lock '%s' is held but its owner is unknown, use 'deployer lock force-unlock %s' if it is stale", name, name)
+	}
+	if time.Now().Before(holder.ExpiresAt) {
+		return fmt.Errorf("deployment lock '%s' is held by %s on %s (pid %d, run %s) since %s",
+			name, holder.Owner, holder.Machine, holder.PID, holder.ID, holder.StartedAt.Local().Format(time.RFC1123))
+	}
+
+	// The lock expired: take it over, unless another deployment took it over
+	// or its holder refreshed it in between.
+	l.logger.Warning("Taking over expired deployment lock '%s' from %s (run %s)", name, holder.Owner, holder.ID)
+	output, _ = l.ssh.RunCommandWithOutput(l.guarded(name, fmt.Sprintf(`[ "$(cat %s/info)" = %s ] && printf %%s %s > %s/info.tmp && mv %s/info.tmp %s/info && echo ACQUIRED`,
+		lockDir, shellwords.Quote(strings.TrimSpace(output)), info, lockDir, lockDir, lockDir)))
+	if strings.TrimSpace(output) != "ACQUIRED" {
+		return fmt.Errorf("deployment lock '%s' was taken by another deployment", name)
+	}
+
+	l.logger.Info("Acquired deployment lock '%s'", name)
+	l.hold(lock)
+	return nil
+}
+
+// Refresh pushes back the expiry of a lock held by run id, so that a
+// deployment running longer than the TTL is not taken over.
+func (l *RemoteLockService) Refresh(name, id string, ttl time.Duration) error {
+	if l.dryRun {
+		return nil
+	}
+
+	l.mu.Lock()
+	lock, held := l.held[name]
+	l.mu.Unlock()
+	if !held || lock.ID != id {
+		return fmt.Errorf("deployment lock '%s' is not held by run %s", name, id)
+	}
+
+	lock.ExpiresAt = time.Now().UTC().Add(ttl)
+	data, err := json.Marshal(lock)
+	if err != nil {
+		return err
+	}
+
+	lockDir := l.lockDir(name)
+	output, err := l.ssh.RunCommandWithOutput(l.guarded(name, fmt.Sprintf(`if grep -qF %s %s/info 2>/dev/null; then printf %%s %s > %s/info.tmp && mv %s/info.tmp %s/info && echo REFRESHED; else echo LOST; fi`,
+		idPattern(id), lockDir, shellwords.Quote(string(data)), lockDir, lockDir, lockDir)))
+	if err != nil {
+		return fmt.Errorf("unable to refresh deployment lock '%s': %w", name, err)
+	}
+	switch strings.TrimSpace(output) {
+	case "REFRESHED":
+		l.hold(lock)
+		l.logger.Debug("Refreshed deployment lock '%s' until %s", name, lock.ExpiresAt.Local().Format(time.RFC1123))
+	case "LOST":
+		return fmt.Errorf("deployment lock '%s' is no longer held by run %s", name, id)
+	default:
+		// Another deployment is inspecting the lock; the next refresh retries.
+		l.logger.Debug("Deployment lock '%s' is busy, not refreshed", name)
+	}
+	return nil
+}
+
+func (l *RemoteLockService) Release(name, id string) error {
+	if l.dryRun {
+		return nil
+	}
+
+	l.mu.Lock()
+	delete(l.held, name)
+	l.mu.Unlock()
+
+	lockDir := l.lockDir(name)
+	output, err := l.ssh.RunCommandWithOutput(l.guarded(name, fmt.Sprintf(`if grep -qF %s %s/info 2>/dev/null; then rm -rf %s && echo RELEASED; fi`,
+		idPattern(id), lockDir, lockDir)))
+	if err != nil {
+		return fmt.Errorf("unable to release deployment lock '%s': %w", name, err)
+	}
+	if strings.TrimSpace(output) != "RELEASED" {
+		return fmt.Errorf("deployment lock '%s' is no longer held by run %s", name, id)
+	}
+
+	l.logger.Info("Released deployment lock '%s'", name)
+	return nil
+}
+
+func (l *RemoteLockService) List() ([]domain.DeploymentLock, error) {
+	cmd := fmt.Sprintf(`for f in %s/*.lock; do [ -d "$f" ] || continue; cat "$f/info" 2>/dev/null || printf '{"name":"%%s"}' "$(basename "$f" .lock)"; echo; done`, shellwords.Quote(l.dir))
+	output, err := l.ssh.RunCommandWithOutput(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list deployment locks: %w", err)
+	}
+
+	var locks []domain.DeploymentLock
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lock, err := parseLock(line)
+		if err != nil {
+			return nil, fmt.Errorf("unreadable lock info %q: %w", line, err)
+		}
+		locks = append(locks, lock)
+	}
+
+	return locks, nil
+}
+
+func (l *RemoteLockService) ForceUnlock(name string) error {
+	lockDir := l.lockDir(name)
+	guardDir := l.guardDir(name)
+	output, err := l.ssh.RunCommandWithOutput(fmt.Sprintf("rm -rf %s; if [ -d %s ]; then rm -rf %s && echo REMOVED; fi", guardDir, lockDir, lockDir))
+	if err != nil {
+		return fmt.Errorf("unable to remove deployment lock '%s': %w", name, err)
+	}
+	if !l.dryRun && strings.TrimSpace(output) != "REMOVED" {
+		return fmt.Errorf("deployment lock '%s' is not held", name)
+	}
+
+	l.logger.Info("Removed deployment lock '%s'", name)
+	return nil
+}
+
+func (l *RemoteLockService) hold(lock domain.DeploymentLock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.held[lock.Name] = lock
+}
+
+// guarded wraps cmd so that it only runs while holding the guard directory of
+// a lock, and prints nothing if another deployment holds the guard.
+func (l *RemoteLockService) guarded(name, cmd string) string {
+	guardDir := l.guardDir(name)
+	return fmt.Sprintf("if mkdir %s 2>/dev/null; then { %s; }; rmdir %s; fi", guardDir, cmd, guardDir)
+}
+
+func (l *RemoteLockService) lockDir(name string) string {
+	return shellwords.Quote(l.lockPath(name))
+}
+
+// guardDir is not matched by the *.lock pattern List looks for.
+func (l *RemoteLockService) guardDir(name string) string {
+	return shellwords.Quote(l.lockPath(name) + ".guard")
+}
+
+func (l *RemoteLockService) lockPath(name string) string {
+	return path.Join(l.dir, unsafeLockChars.ReplaceAllString(name, "_")+".lock")
+}
+
+// idPattern matches the id field of the info file of a lock held by run id.
+func idPattern(id string) string {
+	return shellwords.Quote(fmt.Sprintf(`"id":%q`, id))
+}
+
+func parseLock(data string) (domain.DeploymentLock, error) {
+	var lock domain.DeploymentLock
+	err := json.Unmarshal([]byte(strings.TrimSpace(data)), &lock)
+	return lock, err
+}
+
+// CurrentUser returns the name of the user running the deployer, recorded as
+// the owner of locks and the operator of deployments.
+func CurrentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return "unknown"
+}
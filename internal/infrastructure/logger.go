@@ -0,0 +1,19 @@
+package infrastructure
+
+import (
+	"deployer/internal/domain"
+	"deployer/pkg/logger"
+)
+
+// FieldLogger adapts the console logger to domain.FieldLogger.
+type FieldLogger struct {
+	*logger.Logger
+}
+
+func NewFieldLogger(log *logger.Logger) FieldLogger {
+	return FieldLogger{Logger: log}
+}
+
+func (l FieldLogger) With(fields map[string]string) domain.FieldLogger {
+	return FieldLogger{Logger: l.Logger.With(fields)}
+}
@@ -0,0 +1,84 @@
+package infrastructure
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"deployer/internal/domain"
+)
+
+// templateFuncs are available to notification templates, e.g.
+// {{join .Services ", "}} or {{json .Error}} for a quoted JSON string.
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// eventSummary describes a deployment event in one line.
+func eventSummary(event domain.DeploymentEvent) string {
+	services := strings.Join(event.Services, ", ")
+	target := ""
+	if event.Environment != "" {
+		target = " to " + event.Environment
+	}
+
+	switch event.Type {
+	case domain.EventStarted:
+		return fmt.Sprintf("Deploying %s %s%s", services, event.Version, target)
+	case domain.EventSucceeded:
+		return fmt.Sprintf("Deployed %s %s%s", services, event.Version, target)
+	case domain.EventRolledBack:
+		return fmt.Sprintf("Rolled back %s%s to %s", services, target, event.Version)
+	case domain.EventFailed:
+		if event.FailedStep != "" {
+			return fmt.Sprintf("Deployment of %s %s%s failed at '%s'", services, event.Version, target, event.FailedStep)
+		}
+		return fmt.Sprintf("Deployment of %s %s%s failed", services, event.Version, target)
+	}
+	return fmt.Sprintf("Deployment of %s %s%s: %s", services, event.Version, target, event.Type)
+}
+
+// eventFacts lists the details of a deployment event as name/value pairs.
+func eventFacts(event domain.DeploymentEvent) [][2]string {
+	facts := [][2]string{
+		{"Services", strings.Join(event.Services, ", ")},
+		{"Version", event.Version},
+	}
+	if event.PreviousVersion != "" {
+		facts = append(facts, [2]string{"Previous version", event.PreviousVersion})
+	}
+	if event.Environment != "" {
+		facts = append(facts, [2]string{"Environment", event.Environment})
+	}
+	facts = append(facts, [2]string{"Operator", event.Operator})
+	if event.Type != domain.EventStarted {
+		facts = append(facts, [2]string{"Duration", event.Duration.Round(time.Second).String()})
+	}
+	if event.FailedStep != "" {
+		facts = append(facts, [2]string{"Failed step", event.FailedStep})
+	}
+	if event.Error != "" {
+		facts = append(facts, [2]string{"Error", event.Error})
+	}
+	return append(facts, [2]string{"Run", event.RunID})
+}
+
+// subscribed reports whether a target with the given event filter receives
+// an event. An empty filter receives every event.
+func subscribed(events []string, eventType string) bool {
+	if len(events) == 0 {
+		return true
+	}
+	for _, event := range events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
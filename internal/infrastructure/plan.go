@@ -0,0 +1,122 @@
+package infrastructure
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"deployer/internal/domain"
+)
+
+// PlanRecorder collects the commands a dry run would execute into a
+// domain.Plan, replacing secret values with ${NAME} references.
+type PlanRecorder struct {
+	mu      sync.Mutex
+	service string
+	step    string
+	names   []string
+	secrets map[string]string
+	used    map[string]bool
+	plan    domain.Plan
+}
+
+// NewPlanRecorder creates a recorder masking the given secrets, keyed by the
+// variable name they are replaced with. Empty values are ignored.
+func NewPlanRecorder(secrets map[string]string) *PlanRecorder {
+	p := &PlanRecorder{
+		secrets: make(map[string]string),
+		used:    make(map[string]bool),
+	}
+	for name, value := range secrets {
+		if value != "" {
+			p.secrets[name] = value
+			p.names = append(p.names, name)
+		}
+	}
+
+	// Mask longer secrets first so a secret containing another one is not
+	// partially replaced.
+	sort.Slice(p.names, func(i, j int) bool {
+		a, b := p.secrets[p.names[i]], p.secrets[p.names[j]]
+		if len(a) != len(b) {
+			return len(a) > len(b)
+		}
+		return p.names[i] < p.names[j]
+	})
+	return p
+}
+
+func (p *PlanRecorder) BeginStep(service, step string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.service, p.step = service, step
+}
+
+func (p *PlanRecorder) RecordLocal(dir string, env map[string]string, args []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var vars []string
+	for key, value := range env {
+		vars = append(vars, fmt.Sprintf("%s=%s", key, p.mask(value)))
+	}
+	sort.Strings(vars)
+
+	masked := make([]string, len(args))
+	for i, arg := range args {
+		masked[i] = p.mask(arg)
+	}
+
+	p.plan.Commands = append(p.plan.Commands, domain.PlannedCommand{
+		Service: p.service,
+		Step:    p.step,
+		Target:  "local",
+		Dir:     dir,
+		Env:     vars,
+		Args:    masked,
+	})
+}
+
+// RecordRemote records a command run on target. A stdin of "-" marks a
+// command reading the output of the previously recorded one.
+func (p *PlanRecorder) RecordRemote(target, command, stdin string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cmd := domain.PlannedCommand{
+		Service: p.service,
+		Step:    p.step,
+		Target:  target,
+		Command: p.mask(command),
+		Stdin:   stdin,
+	}
+	if stdin == "-" {
+		cmd.Stdin, cmd.Pipe = "", true
+	}
+	p.plan.Commands = append(p.plan.Commands, cmd)
+}
+
+// Plan returns the commands recorded so far and the names of the secrets
+// masked in them.
+func (p *PlanRecorder) Plan() domain.Plan {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	plan := domain.Plan{Commands: append([]domain.PlannedCommand(nil), p.plan.Commands...)}
+	for name := range p.used {
+		plan.Secrets = append(plan.Secrets, name)
+	}
+	sort.Strings(plan.Secrets)
+	return plan
+}
+
+func (p *PlanRecorder) mask(s string) string {
+	for _, name := range p.names {
+		if strings.Contains(s, p.secrets[name]) {
+			s = strings.ReplaceAll(s, p.secrets[name], "${"+name+"}")
+			p.used[name] = true
+		}
+	}
+	return s
+}
@@ -0,0 +1,400 @@
+package infrastructure
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"deployer/internal/domain"
+)
+
+// manifestTypes are the manifest media types accepted when querying tags, so
+// that the registry reports the digest docker push printed.
+var manifestTypes = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+}
+
+// RegistryClient implements domain.RegistryService with the Docker Registry
+// HTTP API v2. It answers basic auth and bearer token challenges with the
+// configured credentials.
+type RegistryClient struct {
+	client   *http.Client
+	host     string
+	baseURL  string
+	username string
+	password string
+
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+// NewRegistryClient returns a client for the registry of config, over HTTPS
+// unless the registry is marked insecure.
+func NewRegistryClient(config domain.RegistryConfig) *RegistryClient {
+	scheme := "https"
+	if config.Insecure {
+		scheme = "http"
+	}
+	return &RegistryClient{
+		client:   &http.Client{Timeout: 30 * time.Second},
+		host:     config.Host,
+		baseURL:  fmt.Sprintf("%s://%s", scheme, config.Host),
+		username: config.Username,
+		password: config.Password,
+		tokens:   make(map[string]string),
+	}
+}
+
+// CheckCredentials verifies that the registry accepts the configured
+// credentials.
+func (r *RegistryClient) CheckCredentials() error {
+	resp, err := r.do(http.MethodGet, "/v2/", "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("registry %s rejected the credentials of '%s'", r.host, r.username)
+	}
+	return registryError("version check", resp)
+}
+
+func (r *RegistryClient) TagExists(repository, tag string) (bool, error) {
+	resp, err := r.manifest(repository, tag)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, registryError("manifest", resp)
+}
+
+func (r *RegistryClient) ResolveDigest(repository, tag string) (string, error) {
+	resp, err := r.manifest(repository, tag)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("%s:%s does not exist in the registry", repository, tag)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", registryError("manifest", resp)
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("registry did not return a digest for %s:%s", repository, tag)
+	}
+	return digest, nil
+}
+
+// ListTags returns every tag of repository, following the registry's
+// pagination.
+func (r *RegistryClient) ListTags(repository string) ([]string, error) {
+	var tags []string
+	next := fmt.Sprintf("/v2/%s/tags/list", repository)
+	for next != "" {
+		resp, err := r.do(http.MethodGet, next, repository, nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			return nil, nil
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := registryError("tags", resp)
+			resp.Body.Close()
+			return nil, err
+		}
+
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid tags response: %w", err)
+		}
+		tags = append(tags, page.Tags...)
+		next = nextLink(resp.Header.Get("Link"))
+	}
+	return tags, nil
+}
+
+// InspectTag returns the digest of a tag and the creation time of its image,
+// read from the image configuration. For multi-platform images the first
+// platform's configuration is used.
+func (r *RegistryClient) InspectTag(repository, tag string) (*domain.RegistryTag, error) {
+	var manifest imageManifest
+	header, err := r.getJSON(repository, fmt.Sprintf("/v2/%s/manifests/%s", repository, tag), strings.Join(manifestTypes, ", "), &manifest)
+	if err != nil {
+		return nil, err
+	}
+	info := &domain.RegistryTag{Tag: tag, Digest: header.Get("Docker-Content-Digest")}
+
+	if manifest.Config.Digest == "" && len(manifest.Manifests) > 0 {
+		var platform imageManifest
+		if _, err := r.getJSON(repository, fmt.Sprintf("/v2/%s/manifests/%s", repository, manifest.Manifests[0].Digest), strings.Join(manifestTypes, ", "), &platform); err != nil {
+			return nil, err
+		}
+		manifest = platform
+	}
+	if manifest.Config.Digest == "" {
+		return info, nil
+	}
+
+	var config struct {
+		Created time.Time `json:"created"`
+	}
+	if _, err := r.getJSON(repository, fmt.Sprintf("/v2/%s/blobs/%s", repository, manifest.Config.Digest), "", &config); err != nil {
+		return nil, err
+	}
+	info.Created = config.Created
+	return info, nil
+}
+
+// DeleteManifest deletes a manifest, and with it every tag pointing to it.
+// The registry must allow deletes, and its garbage collection frees the
+// storage afterwards.
+func (r *RegistryClient) DeleteManifest(repository, digest string) error {
+	resp, err := r.do(http.MethodDelete, fmt.Sprintf("/v2/%s/manifests/%s", repository, digest), repository, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusAccepted, http.StatusOK, http.StatusNotFound:
+		return nil
+	case http.StatusMethodNotAllowed:
+		return fmt.Errorf("registry %s does not allow deleting manifests", r.host)
+	}
+	return registryError("delete", resp)
+}
+
+// imageManifest is the part of an image manifest or image index read by
+// InspectTag.
+type imageManifest struct {
+	Config struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Manifests []struct {
+		Digest string `json:"digest"`
+	} `json:"manifests"`
+}
+
+// getJSON decodes the response of a GET request into v.
+func (r *RegistryClient) getJSON(repository, path, accept string, v interface{}) (http.Header, error) {
+	var headers map[string]string
+	if accept != "" {
+		headers = map[string]string{"Accept": accept}
+	}
+	resp, err := r.do(http.MethodGet, path, repository, headers)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, registryError("get", resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return nil, fmt.Errorf("invalid registry response for %s: %w", path, err)
+	}
+	return resp.Header, nil
+}
+
+func (r *RegistryClient) manifest(repository, reference string) (*http.Response, error) {
+	path := fmt.Sprintf("/v2/%s/manifests/%s", repository, reference)
+	return r.do(http.MethodHead, path, repository, map[string]string{"Accept": strings.Join(manifestTypes, ", ")})
+}
+
+// do sends a request, authenticating and retrying once when the registry
+// answers with a challenge.
+func (r *RegistryClient) do(method, path, repository string, headers map[string]string) (*http.Response, error) {
+	send := func(authorization string) (*http.Response, error) {
+		req, err := http.NewRequest(method, r.baseURL+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := r.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("registry request failed: %w", err)
+		}
+		return resp, nil
+	}
+
+	r.mu.Lock()
+	token := r.tokens[repository]
+	r.mu.Unlock()
+
+	authorization := ""
+	if token != "" {
+		authorization = "Bearer " + token
+	}
+	resp, err := send(authorization)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		credentials := base64.StdEncoding.EncodeToString([]byte(r.username + ":" + r.password))
+		return send("Basic " + credentials)
+	case "bearer":
+		if params["scope"] == "" && method == http.MethodDelete {
+			params["scope"] = fmt.Sprintf("repository:%s:delete", repository)
+		}
+		token, err := r.fetchToken(params, repository)
+		if err != nil {
+			return nil, err
+		}
+		r.mu.Lock()
+		r.tokens[repository] = token
+		r.mu.Unlock()
+		return send("Bearer " + token)
+	}
+	return nil, fmt.Errorf("registry requires unsupported authentication '%s'", challenge)
+}
+
+// fetchToken obtains a bearer token from the realm of a token challenge.
+func (r *RegistryClient) fetchToken(params map[string]string, repository string) (string, error) {
+	realm := params["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("registry token challenge has no realm")
+	}
+
+	query := url.Values{}
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" && repository != "" {
+		scope = fmt.Sprintf("repository:%s:pull", repository)
+	}
+	if scope != "" {
+		query.Set("scope", scope)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, realm+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("registry token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", registryError("token", resp)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid token response: %w", err)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	if body.AccessToken != "" {
+		return body.AccessToken, nil
+	}
+	return "", fmt.Errorf("registry token response has no token")
+}
+
+// parseChallenge splits a WWW-Authenticate header such as
+// `Bearer realm="https://auth.example.com/token",service="registry"`.
+func parseChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params := make(map[string]string)
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(rest, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		rest = strings.TrimSpace(rest)
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		rest = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+		if key != "" {
+			params[key] = value
+		}
+	}
+	return scheme, params
+}
+
+// nextLink returns the path of the next page from a Link header such as
+// `</v2/app/tags/list?last=1.2&n=100>; rel="next"`.
+func nextLink(header string) string {
+	if !strings.Contains(header, `rel="next"`) {
+		return ""
+	}
+	start, end := strings.Index(header, "<"), strings.Index(header, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	link := header[start+1 : end]
+	if u, err := url.Parse(link); err == nil && u.IsAbs() {
+		return u.RequestURI()
+	}
+	return link
+}
+
+func registryError(operation string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var parsed struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	message := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &parsed) == nil && len(parsed.Errors) > 0 {
+		message = parsed.Errors[0].Message
+	}
+	if message == "" {
+		message = resp.Status
+	}
+	return fmt.Errorf("registry %s request failed (%d): %s", operation, resp.StatusCode, message)
+}
@@ -0,0 +1,309 @@
+package infrastructure
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"deployer/internal/domain"
+)
+
+// newTestRegistry starts a registry serving handler and returns a client for
+// it with the credentials user:secret.
+func newTestRegistry(t *testing.T, handler http.HandlerFunc) (*RegistryClient, *httptest.Server) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client := NewRegistryClient(domain.RegistryConfig{
+		Host:     strings.TrimPrefix(server.URL, "http://"),
+		Username: "user",
+		Password: "secret",
+		Insecure: true,
+	})
+	return client, server
+}
+
+func TestRegistryBasicChallenge(t *testing.T) {
+	client, _ := newTestRegistry(t, func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	exists, err := client.TagExists("app", "1.0.0")
+	if err != nil {
+		t.Fatalf("TagExists: %v", err)
+	}
+	if !exists {
+		t.Error("TagExists = false after answering the basic challenge, want true")
+	}
+}
+
+func TestRegistryBearerChallenge(t *testing.T) {
+	var scopes []string
+	var server *httptest.Server
+	client, server := newTestRegistry(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+				t.Errorf("token request credentials = %q:%q, want user:secret", user, password)
+			}
+			if service := r.URL.Query().Get("service"); service != "registry.test" {
+				t.Errorf("token request service = %q, want registry.test", service)
+			}
+			scopes = append(scopes, r.URL.Query().Get("scope"))
+			json.NewEncoder(w).Encode(map[string]string{"token": "t0ken"})
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer t0ken" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry.test"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for i := 0; i < 2; i++ {
+		exists, err := client.TagExists("app", "1.0.0")
+		if err != nil {
+			t.Fatalf("TagExists: %v", err)
+		}
+		if !exists {
+			t.Error("TagExists = false after answering the bearer challenge, want true")
+		}
+	}
+	if want := []string{"repository:app:pull"}; strings.Join(scopes, " ") != strings.Join(want, " ") {
+		t.Errorf("token scopes = %q, want %q (the token is reused)", scopes, want)
+	}
+}
+
+func TestRegistryTagExists(t *testing.T) {
+	client, _ := newTestRegistry(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("method = %s, want HEAD", r.Method)
+		}
+		if !strings.Contains(r.Header.Get("Accept"), "application/vnd.oci.image.index.v1+json") {
+			t.Errorf("Accept = %q, want the manifest types", r.Header.Get("Accept"))
+		}
+		switch r.URL.Path {
+		case "/v2/app/manifests/1.0.0":
+			w.WriteHeader(http.StatusOK)
+		case "/v2/app/manifests/2.0.0":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+
+	tests := []struct {
+		tag     string
+		want    bool
+		wantErr bool
+	}{
+		{tag: "1.0.0", want: true},
+		{tag: "2.0.0", want: false},
+		{tag: "broken", wantErr: true},
+	}
+	for _, test := range tests {
+		exists, err := client.TagExists("app", test.tag)
+		if (err != nil) != test.wantErr {
+			t.Errorf("TagExists(%s) error = %v, want error %v", test.tag, err, test.wantErr)
+			continue
+		}
+		if exists != test.want {
+			t.Errorf("TagExists(%s) = %v, want %v", test.tag, exists, test.want)
+		}
+	}
+}
+
+func TestRegistryResolveDigest(t *testing.T) {
+	client, _ := newTestRegistry(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/app/manifests/1.0.0":
+			w.Header().Set("Docker-Content-Digest", "sha256:abc")
+			w.WriteHeader(http.StatusOK)
+		case "/v2/app/manifests/nodigest":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	digest, err := client.ResolveDigest("app", "1.0.0")
+	if err != nil {
+		t.Fatalf("ResolveDigest: %v", err)
+	}
+	if digest != "sha256:abc" {
+		t.Errorf("ResolveDigest = %q, want sha256:abc", digest)
+	}
+
+	if _, err := client.ResolveDigest("app", "nodigest"); err == nil {
+		t.Error("ResolveDigest without Docker-Content-Digest succeeded, want an error")
+	}
+	if _, err := client.ResolveDigest("app", "missing"); err == nil {
+		t.Error("ResolveDigest of a missing tag succeeded, want an error")
+	}
+}
+
+func TestRegistryListTagsPagination(t *testing.T) {
+	var server *httptest.Server
+	client, server := newTestRegistry(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/app/tags/list" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.URL.Query().Get("last") {
+		case "":
+			w.Header().Set("Link", `</v2/app/tags/list?last=1.1&n=2>; rel="next"`)
+			json.NewEncoder(w).Encode(map[string]interface{}{"tags": []string{"1.0", "1.1"}})
+		case "1.1":
+			// Some registries return an absolute URL.
+			w.Header().Set("Link", fmt.Sprintf(`<%s/v2/app/tags/list?last=1.3&n=2>; rel="next"`, server.URL))
+			json.NewEncoder(w).Encode(map[string]interface{}{"tags": []string{"1.2", "1.3"}})
+		case "1.3":
+			json.NewEncoder(w).Encode(map[string]interface{}{"tags": []string{"2.0"}})
+		default:
+			t.Errorf("unexpected page after %q", r.URL.Query().Get("last"))
+		}
+	})
+
+	tags, err := client.ListTags("app")
+	if err != nil {
+		t.Fatalf("ListTags: %v", err)
+	}
+	if got, want := strings.Join(tags, " "), "1.0 1.1 1.2 1.3 2.0"; got != want {
+		t.Errorf("ListTags = %s, want %s", got, want)
+	}
+
+	tags, err = client.ListTags("missing")
+	if err != nil || len(tags) != 0 {
+		t.Errorf("ListTags of a missing repository = %v, %v, want no tags", tags, err)
+	}
+}
+
+func TestRegistryCheckCredentials(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{name: "accepted", status: http.StatusOK},
+		{name: "rejected", status: http.StatusUnauthorized, wantErr: true},
+		{name: "forbidden", status: http.StatusForbidden, wantErr: true},
+		{name: "broken", status: http.StatusInternalServerError, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, _ := newTestRegistry(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v2/" {
+					t.Errorf("path = %s, want /v2/", r.URL.Path)
+				}
+				if test.status == http.StatusUnauthorized {
+					w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+				}
+				w.WriteHeader(test.status)
+			})
+
+			err := client.CheckCredentials()
+			if (err != nil) != test.wantErr {
+				t.Errorf("CheckCredentials error = %v, want error %v", err, test.wantErr)
+			}
+			if test.status == http.StatusUnauthorized && (err == nil || !strings.Contains(err.Error(), "rejected the credentials of 'user'")) {
+				t.Errorf("CheckCredentials error = %v, want the credentials rejected", err)
+			}
+		})
+	}
+}
+
+func TestRegistryInspectTag(t *testing.T) {
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	client, _ := newTestRegistry(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/app/manifests/1.0.0":
+			w.Header().Set("Docker-Content-Digest", "sha256:single")
+			fmt.Fprint(w, `{"config":{"digest":"sha256:config"}}`)
+		case "/v2/app/manifests/multi":
+			w.Header().Set("Docker-Content-Digest", "sha256:index")
+			fmt.Fprint(w, `{"manifests":[{"digest":"sha256:amd64"},{"digest":"sha256:arm64"}]}`)
+		case "/v2/app/manifests/sha256:amd64":
+			fmt.Fprint(w, `{"config":{"digest":"sha256:config"}}`)
+		case "/v2/app/blobs/sha256:config":
+			json.NewEncoder(w).Encode(map[string]time.Time{"created": created})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	tests := []struct {
+		tag    string
+		digest string
+	}{
+		{tag: "1.0.0", digest: "sha256:single"},
+		{tag: "multi", digest: "sha256:index"},
+	}
+	for _, test := range tests {
+		info, err := client.InspectTag("app", test.tag)
+		if err != nil {
+			t.Errorf("InspectTag(%s): %v", test.tag, err)
+			continue
+		}
+		if info.Tag != test.tag || info.Digest != test.digest || !info.Created.Equal(created) {
+			t.Errorf("InspectTag(%s) = %+v, want digest %s created %s", test.tag, info, test.digest, created)
+		}
+	}
+
+	if _, err := client.InspectTag("app", "missing"); err == nil {
+		t.Error("InspectTag of a missing tag succeeded, want an error")
+	}
+}
+
+func TestRegistryDeleteManifestScope(t *testing.T) {
+	var scope string
+	var deleted bool
+	var server *httptest.Server
+	client, server := newTestRegistry(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			scope = r.URL.Query().Get("scope")
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "delete-token"})
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer delete-token" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry.test"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodDelete || r.URL.Path != "/v2/app/manifests/sha256:abc" {
+			t.Errorf("request = %s %s, want DELETE /v2/app/manifests/sha256:abc", r.Method, r.URL.Path)
+		}
+		deleted = true
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	if err := client.DeleteManifest("app", "sha256:abc"); err != nil {
+		t.Fatalf("DeleteManifest: %v", err)
+	}
+	if !deleted {
+		t.Error("DeleteManifest did not delete the manifest")
+	}
+	if scope != "repository:app:delete" {
+		t.Errorf("token scope = %q, want repository:app:delete", scope)
+	}
+}
+
+func TestRegistryDeleteManifestDisabled(t *testing.T) {
+	client, _ := newTestRegistry(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	})
+
+	err := client.DeleteManifest("app", "sha256:abc")
+	if err == nil || !strings.Contains(err.Error(), "does not allow deleting") {
+		t.Errorf("DeleteManifest error = %v, want deletes not allowed", err)
+	}
+}
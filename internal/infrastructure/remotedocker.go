@@ -0,0 +1,360 @@
+package infrastructure
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"deployer/internal/domain"
+	"deployer/pkg/shellwords"
+)
+
+// RemoteDockerCLI implements domain.RemoteDockerService by running docker
+// commands on the target server over SSH.
+type RemoteDockerCLI struct {
+	ssh    domain.SSHService
+	logger domain.Logger
+}
+
+func NewRemoteDockerCLI(ssh domain.SSHService, logger domain.Logger) *RemoteDockerCLI {
+	return &RemoteDockerCLI{
+		ssh:    ssh,
+		logger: logger,
+	}
+}
+
+// Ping checks that docker is running on the server.
+func (r *RemoteDockerCLI) Ping() error {
+	output, err := r.ssh.RunCommandWithOutput("docker version --format '{{.Server.Version}}'")
+	if err != nil {
+		return fmt.Errorf("docker is not running on the server: %w: %s", err, strings.TrimSpace(output))
+	}
+	return nil
+}
+
+// DiskFree returns the free space of the filesystem holding the Docker data
+// directory of the server.
+func (r *RemoteDockerCLI) DiskFree() (int64, error) {
+	output, err := r.ssh.RunCommandWithOutput("docker info --format '{{.DockerRootDir}}'")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read docker info: %w", err)
+	}
+	return diskFree(r.ssh, strings.TrimSpace(output))
+}
+
+func (r *RemoteDockerCLI) HasNetwork(name string) (bool, error) {
+	return r.exists("network", name)
+}
+
+func (r *RemoteDockerCLI) HasVolume(name string) (bool, error) {
+	return r.exists("volume", name)
+}
+
+func (r *RemoteDockerCLI) exists(kind, name string) (bool, error) {
+	output, err := r.ssh.RunCommandWithOutput(fmt.Sprintf("docker %s inspect --format '{{.Name}}' %s", kind, shellwords.Quote(name)))
+	if err != nil {
+		lower := strings.ToLower(output)
+		if strings.Contains(lower, "no such") || strings.Contains(lower, "not found") {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to inspect %s %s: %w", kind, name, err)
+	}
+	return true, nil
+}
+
+// PublishedPorts returns the host ports published by running containers.
+func (r *RemoteDockerCLI) PublishedPorts() ([]domain.PublishedPort, error) {
+	output, err := r.ssh.RunCommandWithOutput("docker ps --format '{{.Names}}\t{{.Ports}}'")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	var ports []domain.PublishedPort
+	for _, line := range strings.Split(output, "\n") {
+		name, list, found := strings.Cut(strings.TrimSpace(line), "\t")
+		if !found {
+			continue
+		}
+		ports = append(ports, parsePublishedPorts(name, list)...)
+	}
+	return ports, nil
+}
+
+// Login logs the server into the registry, passing the password on standard
+// input so that it never appears in a command line.
+func (r *RemoteDockerCLI) Login(registry domain.RegistryConfig) error {
+	cmd := fmt.Sprintf("docker login %s -u %s --password-stdin", shellwords.Quote(registry.Host), shellwords.Quote(registry.Username))
+	if output, err := r.ssh.RunCommandWithSecret(cmd, registry.Password); err != nil {
+		return fmt.Errorf("remote docker login failed: %w: %s", err, strings.TrimSpace(output))
+	}
+	return nil
+}
+
+func (r *RemoteDockerCLI) PullImage(image string) error {
+	if err := r.ssh.RunCommand(fmt.Sprintf("docker pull %s", image)); err != nil {
+		return fmt.Errorf("remote docker pull failed: %w", err)
+	}
+	return nil
+}
+
+func (r *RemoteDockerCLI) HasImage(id string) (bool, error) {
+	output, err := r.ssh.RunCommandWithOutput(fmt.Sprintf("docker image inspect --format '{{.Id}}' %s", id))
+	if err != nil {
+		if strings.Contains(output, "No such") {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to inspect image %s: %w", id, err)
+	}
+	return strings.TrimSpace(output) != "", nil
+}
+
+func (r *RemoteDockerCLI) TagImage(source, target string) error {
+	if err := r.ssh.RunCommand(fmt.Sprintf("docker tag %s %s", source, target)); err != nil {
+		return fmt.Errorf("remote docker tag failed: %w", err)
+	}
+	return nil
+}
+
+// LoadImage loads an image archive, which docker load accepts compressed.
+func (r *RemoteDockerCLI) LoadImage(archive io.Reader) error {
+	output, err := r.ssh.RunCommandWithInput("docker load", archive)
+	if err != nil {
+		return fmt.Errorf("remote docker load failed: %w: %s", err, strings.TrimSpace(output))
+	}
+	if output = strings.TrimSpace(output); output != "" {
+		r.logger.Info("%s", output)
+	}
+	return nil
+}
+
+// ListImages returns the tagged images of repository, with their creation
+// time and size read from docker image inspect.
+func (r *RemoteDockerCLI) ListImages(repository string) ([]domain.RemoteImage, error) {
+	output, err := r.ssh.RunCommandWithOutput(fmt.Sprintf("docker image ls --no-trunc --format '{{.ID}} {{.Repository}}:{{.Tag}}' %s", shellwords.Quote(repository)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images of %s: %w", repository, err)
+	}
+
+	var images []domain.RemoteImage
+	var ids []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || strings.HasSuffix(fields[1], ":<none>") {
+			continue
+		}
+		reference := fields[1]
+		images = append(images, domain.RemoteImage{ID: fields[0], Reference: reference, Tag: reference[strings.LastIndex(reference, ":")+1:]})
+		if !seen[fields[0]] {
+			seen[fields[0]] = true
+			ids = append(ids, fields[0])
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	output, err = r.ssh.RunCommandWithOutput("docker image inspect --format '{{.Id}} {{.Created}} {{.Size}}' " + strings.Join(ids, " "))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect images of %s: %w", repository, err)
+	}
+	created := make(map[string]time.Time)
+	sizes := make(map[string]int64)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		created[fields[0]], _ = time.Parse(time.RFC3339Nano, fields[1])
+		sizes[fields[0]], _ = strconv.ParseInt(fields[2], 10, 64)
+	}
+	for i := range images {
+		images[i].Created = created[images[i].ID]
+		images[i].Size = sizes[images[i].ID]
+	}
+	return images, nil
+}
+
+func (r *RemoteDockerCLI) RemoveImage(reference string) error {
+	output, err := r.ssh.RunCommandWithOutput(fmt.Sprintf("docker rmi %s", shellwords.Quote(reference)))
+	if err != nil {
+		return fmt.Errorf("failed to remove image %s: %w: %s", reference, err, strings.TrimSpace(output))
+	}
+	return nil
+}
+
+func (r *RemoteDockerCLI) InspectContainer(name string) (*domain.ContainerState, error) {
+	output, err := r.ssh.RunCommandWithOutput(fmt.Sprintf("docker inspect --type container %s", name))
+	if err != nil {
+		if strings.Contains(output, "No such") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to inspect container %s: %w", name, err)
+	}
+	if strings.TrimSpace(output) == "" {
+		return nil, nil
+	}
+
+	var inspected []containerInspect
+	if err := json.Unmarshal([]byte(output), &inspected); err != nil {
+		return nil, fmt.Errorf("unreadable inspect output for %s: %w", name, err)
+	}
+	if len(inspected) == 0 {
+		return nil, nil
+	}
+	return inspected[0].state(), nil
+}
+
+func (r *RemoteDockerCLI) StopContainer(name string) error {
+	if err := r.ssh.RunCommand(fmt.Sprintf("docker stop %s || true", name)); err != nil {
+		return fmt.Errorf("failed to stop container: %w", err)
+	}
+	return nil
+}
+
+func (r *RemoteDockerCLI) RemoveContainer(name string) error {
+	if err := r.ssh.RunCommand(fmt.Sprintf("docker rm %s || true", name)); err != nil {
+		return fmt.Errorf("failed to remove container: %w", err)
+	}
+	return nil
+}
+
+func (r *RemoteDockerCLI) RunContainer(spec domain.ContainerSpec) error {
+	cmd := fmt.Sprintf("docker run -d --name %s %s %s", spec.Name, spec.Args, spec.Image)
+	if spec.Command != "" {
+		cmd += " " + spec.Command
+	}
+
+	if err := r.ssh.RunCommand(cmd); err != nil {
+		return fmt.Errorf("failed to run container: %w", err)
+	}
+	return nil
+}
+
+func (r *RemoteDockerCLI) RunOnce(spec domain.ContainerSpec) (string, error) {
+	cmd := fmt.Sprintf("docker run --rm %s %s", spec.Args, spec.Image)
+	if spec.Command != "" {
+		cmd += " " + spec.Command
+	}
+
+	output, err := r.ssh.RunCommandWithOutput(cmd)
+	if err != nil {
+		return output, fmt.Errorf("one-off container failed: %w", err)
+	}
+	return output, nil
+}
+
+func (r *RemoteDockerCLI) ContainerLogs(name string, tail int) (string, error) {
+	output, err := r.ssh.RunCommandWithOutput(fmt.Sprintf("docker logs --tail %d %s", tail, name))
+	if err != nil {
+		return "", fmt.Errorf("failed to read logs of %s: %w", name, err)
+	}
+	return output, nil
+}
+
+// parsePublishedPorts parses the ports column of docker ps, such as
+// "0.0.0.0:8080->80/tcp, :::8080->80/tcp, 443/tcp", keeping the ports
+// published on the host.
+func parsePublishedPorts(container, list string) []domain.PublishedPort {
+	var ports []domain.PublishedPort
+	for _, entry := range strings.Split(list, ",") {
+		host, target, found := strings.Cut(strings.TrimSpace(entry), "->")
+		if !found {
+			continue
+		}
+		_, protocol, _ := strings.Cut(target, "/")
+
+		separator := strings.LastIndex(host, ":")
+		if separator < 0 {
+			continue
+		}
+		ip, portRange := host[:separator], host[separator+1:]
+		first, last, isRange := strings.Cut(portRange, "-")
+		if !isRange {
+			last = first
+		}
+		from, err1 := strconv.Atoi(first)
+		to, err2 := strconv.Atoi(last)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		for port := from; port <= to; port++ {
+			ports = append(ports, domain.PublishedPort{Container: container, HostIP: ip, HostPort: port, Protocol: protocol})
+		}
+	}
+	return ports
+}
+
+// diskFree returns the space available in dir on the server, from df.
+func diskFree(ssh domain.SSHService, dir string) (int64, error) {
+	if dir == "" {
+		dir = "/"
+	}
+	output, err := ssh.RunCommandWithOutput("df -Pk " + shellwords.Quote(dir))
+	if err != nil {
+		return 0, fmt.Errorf("failed to check disk space of %s: %w", dir, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) < 2 {
+		return 0, fmt.Errorf("unexpected df output: %s", output)
+	}
+	fields := strings.Fields(lines[1])
+	if len(fields) < 4 {
+		return 0, fmt.Errorf("unexpected df output: %s", output)
+	}
+	available, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected df output: %s", output)
+	}
+	return available * 1024, nil
+}
+
+// containerInspect is the part of a container inspect response the deployer
+// uses, shared by the CLI and the Engine API.
+type containerInspect struct {
+	ID     string `json:"Id"`
+	Name   string `json:"Name"`
+	Image  string `json:"Image"`
+	Config struct {
+		Image  string            `json:"Image"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	State struct {
+		Status    string `json:"Status"`
+		Running   bool   `json:"Running"`
+		ExitCode  int    `json:"ExitCode"`
+		StartedAt string `json:"StartedAt"`
+		Health    *struct {
+			Status string `json:"Status"`
+		} `json:"Health"`
+	} `json:"State"`
+	Mounts []struct {
+		Source      string `json:"Source"`
+		Destination string `json:"Destination"`
+	} `json:"Mounts"`
+}
+
+func (c containerInspect) state() *domain.ContainerState {
+	state := &domain.ContainerState{
+		ID:       c.ID,
+		Name:     strings.TrimPrefix(c.Name, "/"),
+		Image:    c.Config.Image,
+		ImageID:  c.Image,
+		Status:   c.State.Status,
+		Running:  c.State.Running,
+		ExitCode: c.State.ExitCode,
+		Labels:   c.Config.Labels,
+	}
+	state.StartedAt, _ = time.Parse(time.RFC3339Nano, c.State.StartedAt)
+	if c.State.Health != nil {
+		state.Health = c.State.Health.Status
+	}
+	for _, mount := range c.Mounts {
+		state.Mounts = append(state.Mounts, domain.ContainerMount{Source: mount.Source, Destination: mount.Destination})
+	}
+	return state
+}
@@ -0,0 +1,682 @@
+package infrastructure
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"deployer/internal/domain"
+	"deployer/pkg/shellwords"
+)
+
+// RemoteDockerAPI implements domain.RemoteDockerService with the Docker
+// Engine API of the target server, reached by forwarding its socket through
+// the SSH connection.
+type RemoteDockerAPI struct {
+	engine *engine
+	ssh    domain.SSHService
+	logger domain.Logger
+	dryRun bool
+	auth   string
+}
+
+func NewRemoteDockerAPI(ssh domain.SSHService, socket string, logger domain.Logger, dryRun bool) *RemoteDockerAPI {
+	return &RemoteDockerAPI{
+		engine: newDialEngine(func(context.Context) (net.Conn, error) {
+			return ssh.Dial("unix", socket)
+		}),
+		ssh:    ssh,
+		logger: logger,
+		dryRun: dryRun,
+		auth:   base64.URLEncoding.EncodeToString([]byte("{}")),
+	}
+}
+
+func (r *RemoteDockerAPI) Ping() error {
+	if r.dryRun {
+		return nil
+	}
+
+	resp, err := r.engine.request("ping", http.MethodGet, "/_ping", nil, nil)
+	if err != nil {
+		return fmt.Errorf("docker is not running on the server: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// DiskFree returns the free space of the filesystem holding the Docker data
+// directory of the server, which the Engine API does not report itself.
+func (r *RemoteDockerAPI) DiskFree() (int64, error) {
+	if r.dryRun {
+		return 0, nil
+	}
+
+	resp, err := r.engine.request("info", http.MethodGet, "/info", nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var info struct {
+		DockerRootDir string `json:"DockerRootDir"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return 0, fmt.Errorf("invalid info response: %w", err)
+	}
+	return diskFree(r.ssh, info.DockerRootDir)
+}
+
+func (r *RemoteDockerAPI) HasNetwork(name string) (bool, error) {
+	return r.exists("/networks/" + name)
+}
+
+func (r *RemoteDockerAPI) HasVolume(name string) (bool, error) {
+	return r.exists("/volumes/" + name)
+}
+
+func (r *RemoteDockerAPI) exists(path string) (bool, error) {
+	if r.dryRun {
+		return true, nil
+	}
+
+	resp, err := r.engine.request("inspect", http.MethodGet, path, nil, nil)
+	if hasStatus(err, http.StatusNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// PublishedPorts returns the host ports published by running containers.
+func (r *RemoteDockerAPI) PublishedPorts() ([]domain.PublishedPort, error) {
+	if r.dryRun {
+		return nil, nil
+	}
+
+	resp, err := r.engine.request("list", http.MethodGet, "/containers/json", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var containers []struct {
+		Names []string `json:"Names"`
+		Ports []struct {
+			IP         string `json:"IP"`
+			PublicPort int    `json:"PublicPort"`
+			Type       string `json:"Type"`
+		} `json:"Ports"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, fmt.Errorf("invalid container list response: %w", err)
+	}
+
+	var ports []domain.PublishedPort
+	for _, container := range containers {
+		name := ""
+		if len(container.Names) > 0 {
+			name = strings.TrimPrefix(container.Names[0], "/")
+		}
+		for _, port := range container.Ports {
+			if port.PublicPort == 0 {
+				continue
+			}
+			ports = append(ports, domain.PublishedPort{Container: name, HostIP: port.IP, HostPort: port.PublicPort, Protocol: port.Type})
+		}
+	}
+	return ports, nil
+}
+
+func (r *RemoteDockerAPI) Login(registry domain.RegistryConfig) error {
+	r.logger.Info("Remote engine API: POST /auth (%s as %s)", registry.Host, registry.Username)
+
+	data, err := json.Marshal(map[string]string{
+		"username":      registry.Username,
+		"password":      registry.Password,
+		"serveraddress": registry.Host,
+	})
+	if err != nil {
+		return err
+	}
+	r.auth = base64.URLEncoding.EncodeToString(data)
+
+	if r.dryRun {
+		return nil
+	}
+
+	resp, err := r.engine.request("login", http.MethodPost, "/auth", bytes.NewReader(data), map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (r *RemoteDockerAPI) PullImage(image string) error {
+	repository, tag := splitImageTag(image)
+	r.logger.Info("Remote engine API: POST /images/create?fromImage=%s&tag=%s", repository, tag)
+
+	if r.dryRun {
+		return nil
+	}
+
+	query := url.Values{"fromImage": {repository}, "tag": {tag}}
+	resp, err := r.engine.request("pull", http.MethodPost, "/images/create?"+query.Encode(), nil, map[string]string{"X-Registry-Auth": r.auth})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	layers := make(map[string]string)
+	return readStream("pull", resp.Body, func(msg streamMessage) {
+		if msg.ID != "" && msg.Status != "" && layers[msg.ID] != msg.Status && msg.ProgressDetail.Total == 0 {
+			layers[msg.ID] = msg.Status
+			r.logger.Info("Layer %s: %s", msg.ID, msg.Status)
+		}
+	})
+}
+
+func (r *RemoteDockerAPI) HasImage(id string) (bool, error) {
+	if r.dryRun {
+		return false, nil
+	}
+
+	resp, err := r.engine.request("inspect", http.MethodGet, "/images/"+id+"/json", nil, nil)
+	if hasStatus(err, http.StatusNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+func (r *RemoteDockerAPI) TagImage(source, target string) error {
+	repository, tag := splitImageTag(target)
+	r.logger.Info("Remote engine API: POST /images/%s/tag?repo=%s&tag=%s", source, repository, tag)
+	if r.dryRun {
+		return nil
+	}
+
+	query := url.Values{"repo": {repository}, "tag": {tag}}
+	resp, err := r.engine.request("tag", http.MethodPost, "/images/"+source+"/tag?"+query.Encode(), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (r *RemoteDockerAPI) LoadImage(archive io.Reader) error {
+	r.logger.Info("Remote engine API: POST /images/load")
+	if r.dryRun {
+		return nil
+	}
+
+	resp, err := r.engine.request("load", http.MethodPost, "/images/load", archive, map[string]string{"Content-Type": "application/x-tar"})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return readStream("load", resp.Body, func(msg streamMessage) {
+		if msg.Stream != "" {
+			r.logger.Info("%s", strings.TrimSpace(msg.Stream))
+		}
+	})
+}
+
+func (r *RemoteDockerAPI) ListImages(repository string) ([]domain.RemoteImage, error) {
+	if r.dryRun {
+		return nil, nil
+	}
+
+	filters, err := json.Marshal(map[string][]string{"reference": {repository}})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.engine.request("list", http.MethodGet, "/images/json?filters="+url.QueryEscape(string(filters)), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var listed []struct {
+		ID       string   `json:"Id"`
+		RepoTags []string `json:"RepoTags"`
+		Created  int64    `json:"Created"`
+		Size     int64    `json:"Size"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&listed); err != nil {
+		return nil, fmt.Errorf("invalid image list response: %w", err)
+	}
+
+	var images []domain.RemoteImage
+	for _, image := range listed {
+		for _, reference := range image.RepoTags {
+			name, tag := splitImageTag(reference)
+			if name != repository || tag == "<none>" {
+				continue
+			}
+			images = append(images, domain.RemoteImage{
+				ID:        image.ID,
+				Reference: reference,
+				Tag:       tag,
+				Created:   time.Unix(image.Created, 0),
+				Size:      image.Size,
+			})
+		}
+	}
+	return images, nil
+}
+
+func (r *RemoteDockerAPI) RemoveImage(reference string) error {
+	r.logger.Info("Remote engine API: DELETE /images/%s", reference)
+	if r.dryRun {
+		return nil
+	}
+
+	resp, err := r.engine.request("remove", http.MethodDelete, "/images/"+reference, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (r *RemoteDockerAPI) InspectContainer(name string) (*domain.ContainerState, error) {
+	if r.dryRun {
+		return nil, nil
+	}
+
+	resp, err := r.engine.request("inspect", http.MethodGet, "/containers/"+name+"/json", nil, nil)
+	if hasStatus(err, http.StatusNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var inspected containerInspect
+	if err := json.NewDecoder(resp.Body).Decode(&inspected); err != nil {
+		return nil, fmt.Errorf("invalid container inspect response: %w", err)
+	}
+	return inspected.state(), nil
+}
+
+func (r *RemoteDockerAPI) StopContainer(name string) error {
+	r.logger.Info("Remote engine API: POST /containers/%s/stop", name)
+	if r.dryRun {
+		return nil
+	}
+
+	resp, err := r.engine.request("stop", http.MethodPost, "/containers/"+name+"/stop", nil, nil)
+	if hasStatus(err, http.StatusNotModified, http.StatusNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (r *RemoteDockerAPI) RemoveContainer(name string) error {
+	r.logger.Info("Remote engine API: DELETE /containers/%s", name)
+	if r.dryRun {
+		return nil
+	}
+
+	resp, err := r.engine.request("remove", http.MethodDelete, "/containers/"+name, nil, nil)
+	if hasStatus(err, http.StatusNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (r *RemoteDockerAPI) RunContainer(spec domain.ContainerSpec) error {
+	r.logger.Info("Remote engine API: create and start %s from %s", spec.Name, spec.Image)
+	if r.dryRun {
+		return nil
+	}
+
+	id, err := r.create(spec, false)
+	if err != nil {
+		return err
+	}
+	return r.start(id)
+}
+
+func (r *RemoteDockerAPI) RunOnce(spec domain.ContainerSpec) (string, error) {
+	r.logger.Info("Remote engine API: run %s to completion", spec.Image)
+	if r.dryRun {
+		return "", nil
+	}
+
+	spec.Name = ""
+	id, err := r.create(spec, true)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if resp, err := r.engine.request("remove", http.MethodDelete, "/containers/"+id, nil, nil); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	if err := r.start(id); err != nil {
+		return "", err
+	}
+
+	resp, err := r.engine.request("wait", http.MethodPost, "/containers/"+id+"/wait", nil, nil)
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		StatusCode int `json:"StatusCode"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if err != nil {
+		return "", fmt.Errorf("invalid wait response: %w", err)
+	}
+
+	output, _ := r.ContainerLogs(id, 0)
+	if result.StatusCode != 0 {
+		return output, fmt.Errorf("one-off container exited with code %d", result.StatusCode)
+	}
+	return output, nil
+}
+
+func (r *RemoteDockerAPI) ContainerLogs(name string, tail int) (string, error) {
+	if r.dryRun {
+		return "", nil
+	}
+
+	query := url.Values{"stdout": {"1"}, "stderr": {"1"}}
+	if tail > 0 {
+		query.Set("tail", strconv.Itoa(tail))
+	}
+	resp, err := r.engine.request("logs", http.MethodGet, "/containers/"+name+"/logs?"+query.Encode(), nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	return demuxLogs(resp.Body)
+}
+
+func (r *RemoteDockerAPI) create(spec domain.ContainerSpec, oneOff bool) (string, error) {
+	body, err := r.createBody(spec, oneOff)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+
+	path := "/containers/create"
+	if spec.Name != "" {
+		path += "?" + url.Values{"name": {spec.Name}}.Encode()
+	}
+	resp, err := r.engine.request("create", http.MethodPost, path, bytes.NewReader(data), map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var created struct {
+		ID       string   `json:"Id"`
+		Warnings []string `json:"Warnings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return "", fmt.Errorf("invalid create response: %w", err)
+	}
+	for _, warning := range created.Warnings {
+		r.logger.Warning("%s", warning)
+	}
+	return created.ID, nil
+}
+
+func (r *RemoteDockerAPI) start(id string) error {
+	resp, err := r.engine.request("start", http.MethodPost, "/containers/"+id+"/start", nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// createBody translates the docker run arguments of spec into a container
+// create request. Only the options commonly used in docker_run_args are
+// supported; anything else is reported rather than silently dropped. One-off
+// containers ignore --rm: they are removed once their output has been read.
+func (r *RemoteDockerAPI) createBody(spec domain.ContainerSpec, oneOff bool) (map[string]interface{}, error) {
+	args, err := shellwords.Split(spec.Args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker run arguments: %w", err)
+	}
+	command, err := shellwords.Split(spec.Command)
+	if err != nil {
+		return nil, fmt.Errorf("invalid container command: %w", err)
+	}
+
+	config := map[string]interface{}{"Image": spec.Image}
+	host := map[string]interface{}{}
+	var env, binds, volumesFrom, links, extraHosts []string
+	labels := map[string]string{}
+	exposed := map[string]struct{}{}
+	ports := map[string][]map[string]string{}
+
+	for i := 0; i < len(args); i++ {
+		flag, value, hasValue := strings.Cut(args[i], "=")
+		if !strings.HasPrefix(flag, "--") {
+			value, hasValue = "", false
+			flag = args[i]
+		}
+		next := func() (string, error) {
+			if hasValue {
+				return value, nil
+			}
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("docker run option %s needs a value", flag)
+			}
+			i++
+			return args[i], nil
+		}
+
+		var v string
+		switch flag {
+		case "-d", "--detach":
+			continue
+		case "--rm":
+			if !oneOff {
+				host["AutoRemove"] = true
+			}
+			continue
+		case "--privileged":
+			host["Privileged"] = true
+			continue
+		case "--init":
+			host["Init"] = true
+			continue
+		case "--read-only":
+			host["ReadonlyRootfs"] = true
+			continue
+		}
+
+		if v, err = next(); err != nil {
+			return nil, err
+		}
+		switch flag {
+		case "-e", "--env":
+			env = append(env, v)
+		case "--env-file":
+			vars, err := r.readEnvFile(v)
+			if err != nil {
+				return nil, err
+			}
+			env = append(env, vars...)
+		case "-v", "--volume":
+			binds = append(binds, v)
+		case "--volumes-from":
+			volumesFrom = append(volumesFrom, v)
+		case "-p", "--publish":
+			containerPort, binding, err := parsePort(v)
+			if err != nil {
+				return nil, err
+			}
+			exposed[containerPort] = struct{}{}
+			ports[containerPort] = append(ports[containerPort], binding)
+		case "--restart":
+			name, retries, _ := strings.Cut(v, ":")
+			count, _ := strconv.Atoi(retries)
+			host["RestartPolicy"] = map[string]interface{}{"Name": name, "MaximumRetryCount": count}
+		case "--network", "--net":
+			host["NetworkMode"] = v
+		case "--link":
+			links = append(links, v)
+		case "--add-host":
+			extraHosts = append(extraHosts, v)
+		case "-l", "--label":
+			key, val, _ := strings.Cut(v, "=")
+			labels[key] = val
+		case "-w", "--workdir":
+			config["WorkingDir"] = v
+		case "-u", "--user":
+			config["User"] = v
+		case "-h", "--hostname":
+			config["Hostname"] = v
+		case "--entrypoint":
+			config["Entrypoint"] = []string{v}
+		case "--name":
+			return nil, fmt.Errorf("--name is set from container_name, remove it from docker_run_args")
+		default:
+			return nil, fmt.Errorf("docker run option %s is not supported by the remote API client, use remote_client \"cli\"", flag)
+		}
+	}
+
+	if len(command) > 0 {
+		config["Cmd"] = command
+	}
+	config["Env"] = env
+	config["Labels"] = labels
+	config["ExposedPorts"] = exposed
+	host["Binds"] = binds
+	host["VolumesFrom"] = volumesFrom
+	host["PortBindings"] = ports
+	host["Links"] = links
+	host["ExtraHosts"] = extraHosts
+	config["HostConfig"] = host
+	return config, nil
+}
+
+// readEnvFile reads an --env-file from the target server, since the Engine
+// API only accepts the variables themselves.
+func (r *RemoteDockerAPI) readEnvFile(path string) ([]string, error) {
+	output, err := r.ssh.RunCommandWithOutput("cat " + shellwords.Quote(path))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read env file %s: %w", path, err)
+	}
+
+	var vars []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || !strings.Contains(line, "=") {
+			continue
+		}
+		vars = append(vars, line)
+	}
+	return vars, nil
+}
+
+// parsePort parses a -p value ([ip:]hostPort:containerPort[/proto] or
+// containerPort[/proto]) into a container port key and host binding.
+func parsePort(value string) (string, map[string]string, error) {
+	spec, proto, found := strings.Cut(value, "/")
+	if !found {
+		proto = "tcp"
+	}
+
+	parts := strings.Split(spec, ":")
+	binding := map[string]string{"HostIp": "", "HostPort": ""}
+	var containerPort string
+	switch len(parts) {
+	case 1:
+		containerPort = parts[0]
+	case 2:
+		binding["HostPort"], containerPort = parts[0], parts[1]
+	case 3:
+		binding["HostIp"], binding["HostPort"], containerPort = parts[0], parts[1], parts[2]
+	default:
+		return "", nil, fmt.Errorf("invalid port mapping '%s'", value)
+	}
+	if _, err := strconv.Atoi(containerPort); err != nil {
+		return "", nil, fmt.Errorf("invalid port mapping '%s'", value)
+	}
+
+	return containerPort + "/" + proto, binding, nil
+}
+
+// demuxLogs reads a multiplexed stdout/stderr log stream of a container
+// without a TTY.
+func demuxLogs(r io.Reader) (string, error) {
+	reader := bufio.NewReader(r)
+	var out strings.Builder
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(reader, header); err == io.EOF {
+			return out.String(), nil
+		} else if err != nil {
+			return out.String(), err
+		}
+
+		// Containers with a TTY send raw output without frame headers.
+		if header[0] > 2 {
+			out.Write(header)
+			_, err := io.Copy(&out, reader)
+			return out.String(), err
+		}
+
+		size := binary.BigEndian.Uint32(header[4:])
+		if _, err := io.CopyN(&out, reader, int64(size)); err != nil {
+			return out.String(), err
+		}
+	}
+}
+
+func hasStatus(err error, codes ...int) bool {
+	var apiErr *DockerAPIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	for _, code := range codes {
+		if apiErr.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
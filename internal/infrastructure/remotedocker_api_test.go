@@ -0,0 +1,31 @@
+package infrastructure
+
+import (
+	"testing"
+
+	"deployer/internal/domain"
+)
+
+func TestCreateBodyAutoRemove(t *testing.T) {
+	api := &RemoteDockerAPI{}
+	spec := domain.ContainerSpec{Image: "app:1.0.0", Args: "--rm -e MODE=migrate"}
+
+	tests := []struct {
+		name   string
+		oneOff bool
+		want   bool
+	}{
+		{name: "container", oneOff: false, want: true},
+		{name: "one-off", oneOff: true, want: false},
+	}
+	for _, test := range tests {
+		body, err := api.createBody(spec, test.oneOff)
+		if err != nil {
+			t.Fatalf("createBody: %v", err)
+		}
+		host, _ := body["HostConfig"].(map[string]interface{})
+		if autoRemove, _ := host["AutoRemove"].(bool); autoRemove != test.want {
+			t.Errorf("%s: AutoRemove = %v, want %v", test.name, autoRemove, test.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package infrastructure
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"deployer/internal/domain"
+)
+
+// FileRunStore keeps one JSON file per deployment run in a directory.
+type FileRunStore struct {
+	dir string
+}
+
+func NewFileRunStore(dir string) *FileRunStore {
+	return &FileRunStore{
+		dir: dir,
+	}
+}
+
+func (s *FileRunStore) Save(run *domain.DeploymentRun) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("unable to create run directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so an interrupted deploy never leaves
+	// a truncated run record behind.
+	path := s.path(run.ID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("unable to write run %s: %w", run.ID, err)
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func (s *FileRunStore) Load(id string) (*domain.DeploymentRun, error) {
+	data, err := os.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("run %s not found in %s", id, s.dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var run domain.DeploymentRun
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("run %s is corrupt: %w", id, err)
+	}
+
+	return &run, nil
+}
+
+// List returns every recorded run, most recent first. Unreadable records are
+// skipped.
+func (s *FileRunStore) List() ([]*domain.DeploymentRun, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []*domain.DeploymentRun
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".json" {
+			continue
+		}
+		run, err := s.Load(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			continue
+		}
+		runs = append(runs, run)
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+	return runs, nil
+}
+
+func (s *FileRunStore) path(id string) string {
+	return filepath.Join(s.dir, filepath.Base(id)+".json")
+}
@@ -0,0 +1,63 @@
+package infrastructure
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"deployer/internal/domain"
+)
+
+type ShellService struct {
+	logger   domain.Logger
+	dryRun   bool
+	recorder domain.PlanRecorder
+}
+
+func NewShellService(logger domain.Logger, dryRun bool) *ShellService {
+	return &ShellService{
+		logger: logger,
+		dryRun: dryRun,
+	}
+}
+
+// SetRecorder makes the service record every command it would run into a
+// deployment plan.
+func (s *ShellService) SetRecorder(recorder domain.PlanRecorder) {
+	s.recorder = recorder
+}
+
+func (s *ShellService) RunLocal(command string, env map[string]string) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+
+	cmd.Env = os.Environ()
+	for key, value := range env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
+	}
+
+	s.logger.Info("Command: %s", strings.Join(cmd.Args, " "))
+	if s.recorder != nil {
+		s.recorder.RecordLocal("", env, cmd.Args)
+	}
+
+	if s.dryRun {
+		return nil
+	}
+
+	output, err := cmd.CombinedOutput()
+	if len(strings.TrimSpace(string(output))) > 0 {
+		s.logger.Info("Output:\n%s", output)
+	}
+	if err != nil {
+		return fmt.Errorf("local command failed: %w", err)
+	}
+
+	return nil
+}
@@ -3,11 +3,16 @@ package infrastructure
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"deployer/internal/domain"
+	"deployer/pkg/shellwords"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -16,6 +21,11 @@ type SSHService struct {
 	activeConfig domain.SSHConfig
 	logger       domain.Logger
 	dryRun       bool
+	recorder     domain.PlanRecorder
+	secrets      []string
+
+	mu     sync.Mutex
+	tunnel *ssh.Client
 }
 
 func NewSSHService(config domain.SSHConfig, logger domain.Logger, dryRun bool) *SSHService {
@@ -26,16 +36,28 @@ func NewSSHService(config domain.SSHConfig, logger domain.Logger, dryRun bool) *
 	}
 }
 
+// SetRecorder makes the service record every remote command it would run
+// into a deployment plan.
+func (s *SSHService) SetRecorder(recorder domain.PlanRecorder) {
+	s.recorder = recorder
+}
+
+// SetSecrets makes the service redact the given values, such as the registry
+// password, from the commands and output it logs.
+func (s *SSHService) SetSecrets(secrets []string) {
+	s.secrets = redactable(secrets)
+}
+
 func (s *SSHService) Connect(config domain.SSHConfig) error {
 	s.logger.Info("Connecting to: %s@%s:%d", config.Username, config.Host, config.Port)
 
+	// Store the config for use in subsequent commands
+	s.activeConfig = config
+
 	if s.dryRun {
 		return nil
 	}
 
-	// Store the config for use in subsequent commands
-	s.activeConfig = config
-
 	client, err := s.getSSHClientWithConfig(config)
 	if err != nil {
 		return fmt.Errorf("SSH connection failed: %w", err)
@@ -52,12 +74,41 @@ func (s *SSHService) RunCommand(command string) error {
 }
 
 func (s *SSHService) RunCommandWithOutput(command string) (string, error) {
-	s.logger.Info("Remote command: %s", strings.ReplaceAll(command, s.activeConfig.Host, "[HOST]"))
+	s.logCommand(command)
+	s.record(command, "")
 
 	if s.dryRun {
-		return "DRY RUN: Command would be executed", nil
+		return "", nil
 	}
+	return s.run(command, nil)
+}
+
+// RunCommandWithInput runs command with stdin streamed from r. In execution
+// plans the input is shown as piped from the previously recorded command.
+func (s *SSHService) RunCommandWithInput(command string, stdin io.Reader) (string, error) {
+	s.logCommand(command)
+	s.record(command, "-")
+
+	if s.dryRun {
+		return "", nil
+	}
+	return s.run(command, stdin)
+}
+
+// RunCommandWithSecret runs command with secret as its standard input, so
+// that the secret stays out of the command line and of the logs. In
+// execution plans the secret is piped in by printf.
+func (s *SSHService) RunCommandWithSecret(command, secret string) (string, error) {
+	s.logCommand(command)
+	s.record(fmt.Sprintf("printf '%%s\\n' %s | %s", shellwords.Quote(secret), command), "")
 
+	if s.dryRun {
+		return "", nil
+	}
+	return s.run(command, strings.NewReader(secret+"\n"))
+}
+
+func (s *SSHService) run(command string, stdin io.Reader) (string, error) {
 	client, err := s.getSSHClientWithConfig(s.activeConfig)
 	if err != nil {
 		return "", err
@@ -71,6 +122,7 @@ func (s *SSHService) RunCommandWithOutput(command string) (string, error) {
 	defer session.Close()
 
 	var stdout, stderr bytes.Buffer
+	session.Stdin = stdin
 	session.Stdout = &stdout
 	session.Stderr = &stderr
 
@@ -79,10 +131,88 @@ func (s *SSHService) RunCommandWithOutput(command string) (string, error) {
 	if stderr.Len() > 0 {
 		output += "\nSTDERR: " + stderr.String()
 	}
+	s.logOutput(output, err)
 
 	return output, err
 }
 
+func (s *SSHService) logCommand(command string) {
+	s.logger.Info("Remote command: %s", redact(strings.ReplaceAll(command, s.activeConfig.Host, "[HOST]"), s.secrets))
+}
+
+func (s *SSHService) UploadFile(localPath, remotePath string) error {
+	s.logger.Info("Uploading: %s -> %s", localPath, remotePath)
+
+	file, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("unable to open %s: %w", localPath, err)
+	}
+	defer file.Close()
+
+	quoted := shellwords.Quote(remotePath)
+	s.record("cat > "+quoted, localPath)
+
+	if s.dryRun {
+		return nil
+	}
+
+	client, err := s.getSSHClientWithConfig(s.activeConfig)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	session.Stdin = file
+	session.Stderr = &stderr
+
+	if err := session.Run("cat > " + quoted); err != nil {
+		return fmt.Errorf("upload to %s failed: %w: %s", remotePath, err, strings.TrimSpace(stderr.String()))
+	}
+
+	s.logger.Info("Uploaded: %s", remotePath)
+	return nil
+}
+
+// Dial opens a connection from the remote server to address, such as its
+// Docker socket. The SSH connection carrying it is kept open and shared by
+// later calls.
+func (s *SSHService) Dial(network, address string) (net.Conn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tunnel != nil {
+		conn, err := s.tunnel.Dial(network, address)
+		if err == nil {
+			return conn, nil
+		}
+		// The connection may have dropped, reconnect once.
+		s.tunnel.Close()
+		s.tunnel = nil
+	}
+
+	client, err := s.getSSHClientWithConfig(s.activeConfig)
+	if err != nil {
+		return nil, err
+	}
+	s.tunnel = client
+
+	return client.Dial(network, address)
+}
+
+func (s *SSHService) record(command, stdin string) {
+	if s.recorder != nil {
+		target := fmt.Sprintf("%s@%s:%d", s.activeConfig.Username, s.activeConfig.Host, s.activeConfig.Port)
+		s.recorder.RecordRemote(target, command, stdin)
+	}
+}
+
 func (s *SSHService) getSSHClientWithConfig(config domain.SSHConfig) (*ssh.Client, error) {
 	var auth []ssh.AuthMethod
 
@@ -145,4 +275,15 @@ func (s *SSHService) getSSHClient() (*ssh.Client, error) {
 
 	addr := fmt.Sprintf("%s:%d", s.config.Host, s.config.Port)
 	return ssh.Dial("tcp", addr, config)
-}
\ No newline at end of file
+}
+
+// logOutput records the output of a remote command as a debug message, so
+// that it is kept in deployment logs.
+func (s *SSHService) logOutput(output string, err error) {
+	if output = strings.TrimSpace(output); output != "" {
+		s.logger.Debug("Remote output:\n%s", redact(output, s.secrets))
+	}
+	if err != nil {
+		s.logger.Debug("Remote command failed: %s", redact(err.Error(), s.secrets))
+	}
+}
@@ -0,0 +1,55 @@
+package infrastructure
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"deployer/internal/domain"
+)
+
+// messageLogger keeps every message logged.
+type messageLogger struct {
+	messages []string
+}
+
+func (l *messageLogger) log(msg string, args []interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(msg, args...))
+}
+
+func (l *messageLogger) Debug(msg string, args ...interface{})   { l.log(msg, args) }
+func (l *messageLogger) Info(msg string, args ...interface{})    { l.log(msg, args) }
+func (l *messageLogger) Error(msg string, args ...interface{})   { l.log(msg, args) }
+func (l *messageLogger) Warning(msg string, args ...interface{}) { l.log(msg, args) }
+func (l *messageLogger) Success(msg string, args ...interface{}) { l.log(msg, args) }
+
+func TestRemoteLoginKeepsPasswordOutOfLogs(t *testing.T) {
+	logger := &messageLogger{}
+	registry := domain.RegistryConfig{Host: "registry.example.com", Username: "deploy bot", Password: "hunter2"}
+
+	ssh := NewSSHService(domain.SSHConfig{}, logger, true)
+	ssh.SetSecrets([]string{registry.Password})
+	recorder := NewPlanRecorder(map[string]string{"DEPLOYER_REGISTRY_PASSWORD": registry.Password})
+	ssh.SetRecorder(recorder)
+	if err := ssh.Connect(domain.SSHConfig{Host: "10.0.0.5", Username: "deploy", Port: 22}); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+
+	if err := NewRemoteDockerCLI(ssh, logger).Login(registry); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	for _, message := range logger.messages {
+		if strings.Contains(message, registry.Password) {
+			t.Errorf("logged %q, want the password left out", message)
+		}
+	}
+	commands := recorder.Plan().Commands
+	if len(commands) != 1 {
+		t.Fatalf("planned commands = %+v, want the login", commands)
+	}
+	want := `printf '%s\n' '${DEPLOYER_REGISTRY_PASSWORD}' | docker login 'registry.example.com' -u 'deploy bot' --password-stdin`
+	if commands[0].Command != want {
+		t.Errorf("planned command = %s, want %s", commands[0].Command, want)
+	}
+}
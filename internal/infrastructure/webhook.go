@@ -0,0 +1,184 @@
+package infrastructure
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"deployer/internal/domain"
+)
+
+// Webhook payload formats.
+const (
+	WebhookSlack   = "slack"
+	WebhookTeams   = "teams"
+	WebhookGeneric = "generic"
+)
+
+// WebhookNotifier implements domain.Notifier by posting deployment events to
+// webhooks as Slack-compatible messages, Microsoft Teams message cards or
+// generic JSON, optionally rendered from a body template.
+type WebhookNotifier struct {
+	client   *http.Client
+	webhooks []webhook
+}
+
+type webhook struct {
+	config domain.WebhookConfig
+	body   *template.Template
+}
+
+// NewWebhookNotifier returns a notifier for the configured webhooks, failing
+// on an invalid body template.
+func NewWebhookNotifier(configs []domain.WebhookConfig) (*WebhookNotifier, error) {
+	n := &WebhookNotifier{client: &http.Client{Timeout: 10 * time.Second}}
+	for _, config := range configs {
+		hook := webhook{config: config}
+		if config.Body != "" {
+			body, err := template.New(hook.name()).Funcs(templateFuncs).Parse(config.Body)
+			if err != nil {
+				return nil, fmt.Errorf("webhook %s: invalid body template: %w", hook.name(), err)
+			}
+			hook.body = body
+		}
+		n.webhooks = append(n.webhooks, hook)
+	}
+	return n, nil
+}
+
+// Notify posts the event to every webhook subscribed to it and reports the
+// webhooks that failed.
+func (n *WebhookNotifier) Notify(event domain.DeploymentEvent) error {
+	var errs []error
+	for _, hook := range n.webhooks {
+		if !subscribed(hook.config.Events, event.Type) {
+			continue
+		}
+		if err := n.send(hook, event); err != nil {
+			errs = append(errs, fmt.Errorf("webhook %s: %w", hook.name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (n *WebhookNotifier) send(hook webhook, event domain.DeploymentEvent) error {
+	body, err := hook.payload(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, hook.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range hook.config.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// The URL of a webhook often embeds its secret.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// name identifies a webhook in logs without its URL, which may hold a secret.
+func (hook webhook) name() string {
+	if hook.config.Name != "" {
+		return hook.config.Name
+	}
+	if u, err := url.Parse(hook.config.URL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return "(unnamed)"
+}
+
+func (hook webhook) payload(event domain.DeploymentEvent) ([]byte, error) {
+	switch hook.config.Format {
+	case WebhookSlack:
+		return json.Marshal(slackMessage(event))
+	case WebhookTeams:
+		return json.Marshal(teamsCard(event))
+	}
+
+	if hook.body != nil {
+		var body bytes.Buffer
+		if err := hook.body.Execute(&body, event); err != nil {
+			return nil, fmt.Errorf("body template failed: %w", err)
+		}
+		return body.Bytes(), nil
+	}
+	return json.Marshal(map[string]interface{}{
+		"event":            event.Type,
+		"run_id":           event.RunID,
+		"environment":      event.Environment,
+		"services":         event.Services,
+		"version":          event.Version,
+		"previous_version": event.PreviousVersion,
+		"operator":         event.Operator,
+		"duration_seconds": int(event.Duration.Seconds()),
+		"failed_step":      event.FailedStep,
+		"error":            event.Error,
+		"time":             event.Time.UTC().Format(time.RFC3339),
+	})
+}
+
+func slackMessage(event domain.DeploymentEvent) map[string]interface{} {
+	var fields []map[string]interface{}
+	for _, fact := range eventFacts(event) {
+		fields = append(fields, map[string]interface{}{"title": fact[0], "value": fact[1], "short": len(fact[1]) < 40})
+	}
+	return map[string]interface{}{
+		"text": eventSummary(event),
+		"attachments": []map[string]interface{}{{
+			"color":  "#" + eventColor(event.Type),
+			"fields": fields,
+		}},
+	}
+}
+
+func teamsCard(event domain.DeploymentEvent) map[string]interface{} {
+	var facts []map[string]string
+	for _, fact := range eventFacts(event) {
+		facts = append(facts, map[string]string{"name": fact[0], "value": fact[1]})
+	}
+	return map[string]interface{}{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"themeColor": eventColor(event.Type),
+		"summary":    eventSummary(event),
+		"title":      eventSummary(event),
+		"sections":   []map[string]interface{}{{"facts": facts}},
+	}
+}
+
+func eventColor(eventType string) string {
+	switch eventType {
+	case domain.EventSucceeded:
+		return "2EB886"
+	case domain.EventFailed:
+		return "D72B3F"
+	case domain.EventRolledBack:
+		return "DAA038"
+	}
+	return "439FE0"
+}
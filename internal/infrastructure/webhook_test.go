@@ -0,0 +1,275 @@
+package infrastructure
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"deployer/internal/domain"
+)
+
+// webhookRequest is a request received by a test webhook.
+type webhookRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// newTestWebhook starts a webhook answering with status and returns its URL
+// and the requests it received.
+func newTestWebhook(t *testing.T, status int) (string, <-chan webhookRequest) {
+	t.Helper()
+	received := make(chan webhookRequest, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- webhookRequest{header: r.Header, body: body}
+		w.WriteHeader(status)
+		io.WriteString(w, "webhook says no")
+	}))
+	t.Cleanup(server.Close)
+	return server.URL + "/hooks/s3cr3t", received
+}
+
+func testEvent(eventType string) domain.DeploymentEvent {
+	return domain.DeploymentEvent{
+		Type:            eventType,
+		RunID:           "20260301-120000-abcdef",
+		Environment:     "production",
+		Services:        []string{"api", "worker"},
+		Version:         "1.4.0",
+		PreviousVersion: "1.3.2",
+		Operator:        "alice",
+		Duration:        95 * time.Second,
+		FailedStep:      "Verifying container health",
+		Error:           "container exited with code 1",
+		Time:            time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func notifyOne(t *testing.T, config domain.WebhookConfig, event domain.DeploymentEvent) error {
+	t.Helper()
+	notifier, err := NewWebhookNotifier([]domain.WebhookConfig{config})
+	if err != nil {
+		t.Fatalf("NewWebhookNotifier: %v", err)
+	}
+	return notifier.Notify(event)
+}
+
+func receive(t *testing.T, received <-chan webhookRequest) webhookRequest {
+	t.Helper()
+	select {
+	case request := <-received:
+		return request
+	default:
+		t.Fatal("the webhook received no request")
+		return webhookRequest{}
+	}
+}
+
+func TestWebhookSlackPayload(t *testing.T) {
+	url, received := newTestWebhook(t, http.StatusOK)
+	if err := notifyOne(t, domain.WebhookConfig{URL: url, Format: WebhookSlack}, testEvent(domain.EventFailed)); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	var message struct {
+		Text        string `json:"text"`
+		Attachments []struct {
+			Color  string `json:"color"`
+			Fields []struct {
+				Title string `json:"title"`
+				Value string `json:"value"`
+			} `json:"fields"`
+		} `json:"attachments"`
+	}
+	request := receive(t, received)
+	if err := json.Unmarshal(request.body, &message); err != nil {
+		t.Fatalf("invalid Slack payload %s: %v", request.body, err)
+	}
+	if !strings.Contains(message.Text, "api, worker") || !strings.Contains(message.Text, "1.4.0") {
+		t.Errorf("text = %q, want the services and version", message.Text)
+	}
+	if len(message.Attachments) != 1 || message.Attachments[0].Color != "#D72B3F" {
+		t.Fatalf("attachments = %+v, want one red attachment", message.Attachments)
+	}
+	fields := make(map[string]string)
+	for _, field := range message.Attachments[0].Fields {
+		fields[field.Title] = field.Value
+	}
+	if fields["Environment"] != "production" {
+		t.Errorf("fields = %v, want the environment", fields)
+	}
+	if got := request.header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+}
+
+func TestWebhookTeamsPayload(t *testing.T) {
+	url, received := newTestWebhook(t, http.StatusOK)
+	if err := notifyOne(t, domain.WebhookConfig{URL: url, Format: WebhookTeams}, testEvent(domain.EventSucceeded)); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	var card struct {
+		Type       string `json:"@type"`
+		ThemeColor string `json:"themeColor"`
+		Title      string `json:"title"`
+		Sections   []struct {
+			Facts []struct {
+				Name  string `json:"name"`
+				Value string `json:"value"`
+			} `json:"facts"`
+		} `json:"sections"`
+	}
+	request := receive(t, received)
+	if err := json.Unmarshal(request.body, &card); err != nil {
+		t.Fatalf("invalid Teams payload %s: %v", request.body, err)
+	}
+	if card.Type != "MessageCard" || card.ThemeColor != "2EB886" {
+		t.Errorf("card = %+v, want a green MessageCard", card)
+	}
+	if !strings.Contains(card.Title, "1.4.0") {
+		t.Errorf("title = %q, want the version", card.Title)
+	}
+	if len(card.Sections) != 1 || len(card.Sections[0].Facts) == 0 {
+		t.Errorf("sections = %+v, want one section of facts", card.Sections)
+	}
+}
+
+func TestWebhookGenericPayload(t *testing.T) {
+	url, received := newTestWebhook(t, http.StatusOK)
+	if err := notifyOne(t, domain.WebhookConfig{URL: url}, testEvent(domain.EventFailed)); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	var payload map[string]interface{}
+	request := receive(t, received)
+	if err := json.Unmarshal(request.body, &payload); err != nil {
+		t.Fatalf("invalid generic payload %s: %v", request.body, err)
+	}
+	want := map[string]interface{}{
+		"event":            domain.EventFailed,
+		"run_id":           "20260301-120000-abcdef",
+		"environment":      "production",
+		"version":          "1.4.0",
+		"previous_version": "1.3.2",
+		"operator":         "alice",
+		"duration_seconds": float64(95),
+		"failed_step":      "Verifying container health",
+		"error":            "container exited with code 1",
+		"time":             "2026-03-01T12:00:00Z",
+	}
+	for key, value := range want {
+		if payload[key] != value {
+			t.Errorf("%s = %v, want %v", key, payload[key], value)
+		}
+	}
+	if services, _ := payload["services"].([]interface{}); len(services) != 2 {
+		t.Errorf("services = %v, want api and worker", payload["services"])
+	}
+}
+
+func TestWebhookBodyTemplate(t *testing.T) {
+	url, received := newTestWebhook(t, http.StatusOK)
+	config := domain.WebhookConfig{
+		URL:  url,
+		Body: `{"text": "{{.Type}} {{join .Services "+"}} {{.Version}} by {{.Operator}}"}`,
+	}
+	if err := notifyOne(t, config, testEvent(domain.EventStarted)); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	request := receive(t, received)
+	if got, want := string(request.body), `{"text": "started api+worker 1.4.0 by alice"}`; got != want {
+		t.Errorf("body = %s, want %s", got, want)
+	}
+}
+
+func TestWebhookInvalidBodyTemplate(t *testing.T) {
+	_, err := NewWebhookNotifier([]domain.WebhookConfig{{Name: "chat", URL: "http://localhost", Body: "{{.Type"}})
+	if err == nil || !strings.Contains(err.Error(), "webhook chat") {
+		t.Errorf("NewWebhookNotifier error = %v, want an invalid template of webhook chat", err)
+	}
+}
+
+func TestWebhookEventFilter(t *testing.T) {
+	url, received := newTestWebhook(t, http.StatusOK)
+	notifier, err := NewWebhookNotifier([]domain.WebhookConfig{{URL: url, Events: []string{domain.EventFailed, domain.EventRolledBack}}})
+	if err != nil {
+		t.Fatalf("NewWebhookNotifier: %v", err)
+	}
+
+	for _, eventType := range []string{domain.EventStarted, domain.EventSucceeded, domain.EventFailed, domain.EventRolledBack} {
+		if err := notifier.Notify(testEvent(eventType)); err != nil {
+			t.Fatalf("Notify(%s): %v", eventType, err)
+		}
+	}
+
+	var events []string
+	for len(received) > 0 {
+		var payload struct {
+			Event string `json:"event"`
+		}
+		json.Unmarshal((<-received).body, &payload)
+		events = append(events, payload.Event)
+	}
+	if got, want := strings.Join(events, " "), domain.EventFailed+" "+domain.EventRolledBack; got != want {
+		t.Errorf("events sent = %s, want %s", got, want)
+	}
+}
+
+func TestWebhookHeaders(t *testing.T) {
+	url, received := newTestWebhook(t, http.StatusOK)
+	config := domain.WebhookConfig{
+		URL:     url,
+		Headers: map[string]string{"Authorization": "Bearer hook-token", "X-Source": "deployer"},
+	}
+	if err := notifyOne(t, config, testEvent(domain.EventStarted)); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	request := receive(t, received)
+	if got := request.header.Get("Authorization"); got != "Bearer hook-token" {
+		t.Errorf("Authorization = %q, want Bearer hook-token", got)
+	}
+	if got := request.header.Get("X-Source"); got != "deployer" {
+		t.Errorf("X-Source = %q, want deployer", got)
+	}
+}
+
+func TestWebhookFailure(t *testing.T) {
+	url, _ := newTestWebhook(t, http.StatusInternalServerError)
+	err := notifyOne(t, domain.WebhookConfig{Name: "chat", URL: url}, testEvent(domain.EventStarted))
+	if err == nil {
+		t.Fatal("Notify succeeded against a failing webhook, want an error")
+	}
+	if !strings.Contains(err.Error(), "webhook chat: status 500: webhook says no") {
+		t.Errorf("error = %v, want the webhook name, status and response", err)
+	}
+}
+
+func TestWebhookTimeoutHidesURL(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	notifier, err := NewWebhookNotifier([]domain.WebhookConfig{{URL: server.URL + "/hooks/s3cr3t"}})
+	if err != nil {
+		t.Fatalf("NewWebhookNotifier: %v", err)
+	}
+	notifier.client.Timeout = 50 * time.Millisecond
+
+	err = notifier.Notify(testEvent(domain.EventStarted))
+	if err == nil {
+		t.Fatal("Notify succeeded against a webhook that never answers, want an error")
+	}
+	if strings.Contains(err.Error(), "s3cr3t") {
+		t.Errorf("error = %v, want the webhook URL left out", err)
+	}
+}
@@ -13,6 +13,10 @@ import (
 type CLI struct {
 	configRepo domain.ConfigRepository
 	deployment domain.DeploymentService
+	registry   domain.RegistryService
+	git        domain.SourceControl
+	operator   string
+	plain      bool
 	logger     domain.Logger
 }
 
@@ -24,15 +28,34 @@ func NewCLI(configRepo domain.ConfigRepository, deployment domain.DeploymentServ
 	}
 }
 
+// SetRegistry lets interactive mode suggest the versions available in the
+// registry when asking for a version.
+func (c *CLI) SetRegistry(registry domain.RegistryService) {
+	c.registry = registry
+}
+
+// SetSourceControl lets interactive mode suggest the version derived from
+// the git checkout of the selected service.
+func (c *CLI) SetSourceControl(git domain.SourceControl) {
+	c.git = git
+}
+
+// SetOperator sets the user reported as running the deployments started
+// from interactive mode.
+func (c *CLI) SetOperator(operator string) {
+	c.operator = operator
+}
+
+// SetColor turns the colors of interactive mode on (the default) or off.
+func (c *CLI) SetColor(enabled bool) {
+	c.plain = !enabled
+}
+
 func (c *CLI) RunInteractiveMode(configFile string) {
-	const (
-		bold   = "\033[1m"
-		cyan   = "\033[36m"
-		reset  = "\033[0m"
-		green  = "\033[32m"
-		red    = "\033[31m"
-		yellow = "\033[33m"
-	)
+	bold, cyan, reset, green, red, yellow := "\033[1m", "\033[36m", "\033[0m", "\033[32m", "\033[31m", "\033[33m"
+	if c.plain {
+		bold, cyan, reset, green, red, yellow = "", "", "", "", "", ""
+	}
 	
 	fmt.Printf("%s%sDeployer v0.1 - Repsoft Limited%s\n", bold, cyan, reset)
 	fmt.Printf("%s===============================%s\n", cyan, reset)
@@ -69,9 +92,19 @@ func (c *CLI) RunInteractiveMode(configFile string) {
 		return
 	}
 
-	fmt.Print("Enter version (e.g., 1.0.0): ")
+	c.showRecentTags(config.Services[serviceName].ImageName)
+
+	suggested := c.suggestVersion(config.Services[serviceName])
+	if suggested != "" {
+		fmt.Printf("Enter version (Enter for %s): ", suggested)
+	} else {
+		fmt.Print("Enter version (e.g., 1.0.0): ")
+	}
 	scanner.Scan()
 	version := strings.TrimSpace(scanner.Text())
+	if version == "" {
+		version = suggested
+	}
 
 	if version == "" {
 		fmt.Println("ERROR: Version cannot be empty!")
@@ -107,6 +140,7 @@ func (c *CLI) RunInteractiveMode(configFile string) {
 		Version:          version,
 		BuildPathOverride: buildPathOverride,
 		DryRun:           dryRun,
+		Operator:          c.operator,
 	}
 
 	if err := c.deployment.Deploy(request, config); err != nil {
@@ -137,6 +171,43 @@ func (c *CLI) ListServices(configFile string) {
 	}
 }
 
+// suggestVersion returns the version derived from the git checkout of the
+// service's build path, if any.
+func (c *CLI) suggestVersion(serviceConfig domain.DeployConfig) string {
+	if c.git == nil || serviceConfig.BuildPath == "" {
+		return ""
+	}
+	version, err := c.git.Version(serviceConfig.BuildPath)
+	if err != nil {
+		c.logger.Warning("Unable to derive a version from git: %v", err)
+		return ""
+	}
+	return version
+}
+
+// showRecentTags prints the newest versions of an image in the registry, to
+// help pick one when rolling back.
+func (c *CLI) showRecentTags(imageName string) {
+	if c.registry == nil {
+		return
+	}
+
+	tags, err := c.registry.ListTags(imageName)
+	if err != nil {
+		c.logger.Warning("Unable to list registry tags: %v", err)
+		return
+	}
+	if len(tags) == 0 {
+		return
+	}
+
+	SortVersionsDescending(tags)
+	if len(tags) > 10 {
+		tags = tags[:10]
+	}
+	fmt.Printf("Recent versions in registry: %s\n", strings.Join(tags, ", "))
+}
+
 func (c *CLI) parseNumber(s string) int {
 	num, err := strconv.Atoi(s)
 	if err != nil {
@@ -0,0 +1,169 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"deployer/internal/domain"
+)
+
+// WritePlan renders a dry-run plan as "text", "json" or "script". The script
+// format is a POSIX shell script that performs the deployment when run with
+// the masked secrets exported as environment variables.
+func WritePlan(w io.Writer, plan domain.Plan, format string) error {
+	switch format {
+	case "text":
+		return writePlanText(w, plan)
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(plan)
+	case "script":
+		return writePlanScript(w, plan)
+	}
+	return fmt.Errorf("unknown plan format '%s' (expected text, json or script)", format)
+}
+
+func writePlanText(w io.Writer, plan domain.Plan) error {
+	fmt.Fprintln(w, "Deployment plan")
+	fmt.Fprintln(w, "===============")
+
+	heading := ""
+	for _, cmd := range plan.Commands {
+		if h := planHeading(cmd); h != heading {
+			fmt.Fprintf(w, "\n%s\n", h)
+			heading = h
+		}
+		if cmd.Target == "local" {
+			fmt.Fprintf(w, "  local$ %s\n", localCommandLine(cmd, plan.Secrets))
+		} else {
+			fmt.Fprintf(w, "  %s$ %s\n", cmd.Target, remoteCommandText(cmd))
+		}
+	}
+
+	if len(plan.Secrets) > 0 {
+		fmt.Fprintf(w, "\nMasked secrets: %s\n", strings.Join(plan.Secrets, ", "))
+	}
+	return nil
+}
+
+func writePlanScript(w io.Writer, plan domain.Plan) error {
+	fmt.Fprintln(w, "#!/bin/sh")
+	fmt.Fprintln(w, "# Deployment plan generated by deployer")
+	fmt.Fprintln(w, "set -eu")
+	for _, secret := range plan.Secrets {
+		fmt.Fprintf(w, ": \"${%s:?must be set}\"\n", secret)
+	}
+
+	// Lines are written one command late so that a piped command can be
+	// joined to the line of the command feeding it.
+	heading, pending := "", ""
+	for _, cmd := range plan.Commands {
+		var line string
+		if cmd.Target == "local" {
+			line = localCommandLine(cmd, plan.Secrets)
+		} else {
+			user, port := cmd.Target, "22"
+			if i := strings.LastIndex(user, ":"); i >= 0 {
+				user, port = user[:i], user[i+1:]
+			}
+			line = fmt.Sprintf("ssh -p %s %s %s", port, user, doubleQuote(cmd.Command, plan.Secrets))
+			if cmd.Stdin != "" {
+				line += " < " + shellArg(cmd.Stdin, plan.Secrets)
+			}
+		}
+
+		if cmd.Pipe && pending != "" {
+			pending += " | " + line
+			continue
+		}
+		if pending != "" {
+			fmt.Fprintln(w, pending)
+		}
+		if h := planHeading(cmd); h != heading {
+			fmt.Fprintf(w, "\n# %s\n", h)
+			heading = h
+		}
+		pending = line
+	}
+	if pending != "" {
+		fmt.Fprintln(w, pending)
+	}
+	return nil
+}
+
+func planHeading(cmd domain.PlannedCommand) string {
+	if cmd.Service == "" {
+		return cmd.Step
+	}
+	return fmt.Sprintf("[%s] %s", cmd.Service, cmd.Step)
+}
+
+func localCommandLine(cmd domain.PlannedCommand, secrets []string) string {
+	parts := make([]string, 0, len(cmd.Env)+len(cmd.Args))
+	for _, env := range cmd.Env {
+		key, value, _ := strings.Cut(env, "=")
+		parts = append(parts, key+"="+shellArg(value, secrets))
+	}
+	for _, arg := range cmd.Args {
+		parts = append(parts, shellArg(arg, secrets))
+	}
+
+	line := strings.Join(parts, " ")
+	if cmd.Dir != "" {
+		line = fmt.Sprintf("(cd %s && %s)", shellArg(cmd.Dir, secrets), line)
+	}
+	return line
+}
+
+func remoteCommandText(cmd domain.PlannedCommand) string {
+	if cmd.Pipe {
+		return "| " + cmd.Command
+	}
+	if cmd.Stdin != "" {
+		return fmt.Sprintf("%s < %s", cmd.Command, cmd.Stdin)
+	}
+	return cmd.Command
+}
+
+// shellArg quotes arg for the shell when it contains anything but plain
+// characters.
+func shellArg(arg string, secrets []string) string {
+	if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:@=,+%") == "" {
+		return arg
+	}
+	return doubleQuote(arg, secrets)
+}
+
+// doubleQuote quotes s in double quotes, leaving ${NAME} references to the
+// masked secrets unescaped so the shell expands them.
+func doubleQuote(s string, secrets []string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '$' {
+			if ref := secretReference(s[i:], secrets); ref != "" {
+				b.WriteString(ref)
+				i += len(ref) - 1
+				continue
+			}
+		}
+		if strings.IndexByte("\\\"$`", s[i]) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func secretReference(s string, secrets []string) string {
+	for _, secret := range secrets {
+		if ref := "${" + secret + "}"; strings.HasPrefix(s, ref) {
+			return ref
+		}
+	}
+	return ""
+}
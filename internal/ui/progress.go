@@ -0,0 +1,228 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"deployer/internal/domain"
+)
+
+// Progress rendering modes.
+const (
+	ProgressAuto  = "auto"
+	ProgressBar   = "bar"
+	ProgressPlain = "plain"
+	ProgressJSON  = "json"
+	ProgressNone  = "none"
+)
+
+// NewProgress returns the renderer writing the progress of deployments to
+// out: "bar" redraws a progress bar, in color if color is set, "plain"
+// prints a line whenever the progress changes, "json" writes every event as
+// a JSON line and "none" shows nothing. "auto" is "bar" when out is a
+// terminal and "plain" otherwise.
+func NewProgress(mode string, out io.Writer, terminal, color bool) (domain.ProgressObserver, error) {
+	switch mode {
+	case ProgressAuto, "":
+		if terminal {
+			return NewBarProgress(out, color), nil
+		}
+		return NewPlainProgress(out), nil
+	case ProgressBar:
+		return NewBarProgress(out, color), nil
+	case ProgressPlain:
+		return NewPlainProgress(out), nil
+	case ProgressJSON:
+		return NewJSONProgress(out), nil
+	case ProgressNone:
+		return NoProgress{}, nil
+	}
+	return nil, fmt.Errorf("unknown progress mode '%s' (expected auto, bar, plain, json or none)", mode)
+}
+
+// BarProgress draws a progress bar redrawn in place on a terminal. When
+// several services deploy at once, the bar shows their average progress
+// followed by the progress of each service.
+type BarProgress struct {
+	out      io.Writer
+	color    bool
+	services []string
+	percent  map[string]int
+	mu       sync.Mutex
+}
+
+func NewBarProgress(out io.Writer, color bool) *BarProgress {
+	return &BarProgress{out: out, color: color, percent: make(map[string]int)}
+}
+
+func (p *BarProgress) Observe(event domain.ProgressEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch event.Type {
+	case domain.ProgressStepStarted, domain.ProgressStepFinished:
+		if _, seen := p.percent[event.Service]; !seen {
+			p.services = append(p.services, event.Service)
+		}
+		p.percent[event.Service] = event.Percent
+		p.draw()
+	case domain.ProgressStepFailed:
+		// Leave the bar where the step failed, and go on with the
+		// services still deploying on a new line.
+		fmt.Fprintln(p.out)
+		p.forget(event.Service)
+	}
+}
+
+// forget stops tracking the progress of a service.
+func (p *BarProgress) forget(service string) {
+	delete(p.percent, service)
+	for i, name := range p.services {
+		if name == service {
+			p.services = append(p.services[:i], p.services[i+1:]...)
+			break
+		}
+	}
+}
+
+// draw redraws the bar with the average progress of the services, and
+// starts a new line once they all completed.
+func (p *BarProgress) draw() {
+	total := 0
+	for _, service := range p.services {
+		total += p.percent[service]
+	}
+	progress := total / len(p.services)
+
+	var details string
+	if len(p.services) > 1 {
+		parts := make([]string, len(p.services))
+		for i, service := range p.services {
+			parts[i] = fmt.Sprintf("%s %3d%%", service, p.percent[service])
+		}
+		details = " (" + strings.Join(parts, ", ") + ")"
+	}
+	p.drawBar(progress, details)
+
+	if progress == 100 {
+		p.services = nil
+		p.percent = make(map[string]int)
+	}
+}
+
+func (p *BarProgress) drawBar(progress int, details string) {
+	const (
+		width = 50
+		green = "\033[32m"
+		blue  = "\033[34m"
+		reset = "\033[0m"
+		bold  = "\033[1m"
+	)
+
+	filled := int(float64(width) * float64(progress) / 100.0)
+	filledBar := strings.Repeat("█", filled)
+	emptyBar := strings.Repeat("░", width-filled)
+
+	if !p.color {
+		fmt.Fprintf(p.out, "\r[%s%s] %d%%%s", filledBar, emptyBar, progress, details)
+	} else {
+		var color string
+		if progress == 100 {
+			color = green
+		} else {
+			color = blue
+		}
+
+		fmt.Fprintf(p.out, "\r%s%s[%s%s%s%s] %s%d%%%s%s%s",
+			bold, color, green, filledBar, reset, emptyBar, bold, progress, reset, reset, details)
+	}
+	if progress == 100 {
+		fmt.Fprintln(p.out)
+	}
+}
+
+// PlainProgress prints a line whenever the progress of a service changes,
+// for output that is not a terminal.
+type PlainProgress struct {
+	out  io.Writer
+	last map[string]int
+	mu   sync.Mutex
+}
+
+func NewPlainProgress(out io.Writer) *PlainProgress {
+	return &PlainProgress{out: out, last: make(map[string]int)}
+}
+
+func (p *PlainProgress) Observe(event domain.ProgressEvent) {
+	if event.Type != domain.ProgressStepStarted && event.Type != domain.ProgressStepFinished {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if last, seen := p.last[event.Service]; seen && last == event.Percent {
+		return
+	}
+	p.last[event.Service] = event.Percent
+	fmt.Fprintf(p.out, "Progress: %d%% (%s)\n", event.Percent, event.Service)
+	if event.Percent == 100 {
+		delete(p.last, event.Service)
+	}
+}
+
+// JSONProgress writes every event as one JSON object per line.
+type JSONProgress struct {
+	encoder *json.Encoder
+	mu      sync.Mutex
+}
+
+func NewJSONProgress(out io.Writer) *JSONProgress {
+	return &JSONProgress{encoder: json.NewEncoder(out)}
+}
+
+type progressLine struct {
+	Time       string `json:"time"`
+	Type       string `json:"type"`
+	RunID      string `json:"run_id,omitempty"`
+	Service    string `json:"service,omitempty"`
+	Step       string `json:"step,omitempty"`
+	Index      int    `json:"index,omitempty"`
+	Total      int    `json:"total,omitempty"`
+	Percent    *int   `json:"percent,omitempty"`
+	DurationMS int64  `json:"duration_ms,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Level      string `json:"level,omitempty"`
+	Message    string `json:"message,omitempty"`
+}
+
+func (p *JSONProgress) Observe(event domain.ProgressEvent) {
+	line := progressLine{
+		Time:       event.Time.UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+		Type:       event.Type,
+		RunID:      event.RunID,
+		Service:    event.Service,
+		Step:       event.Step,
+		Index:      event.Index,
+		Total:      event.Total,
+		DurationMS: event.Duration.Milliseconds(),
+		Error:      event.Error,
+		Level:      event.Level,
+		Message:    event.Message,
+	}
+	if event.Type != domain.ProgressLog {
+		percent := event.Percent
+		line.Percent = &percent
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.encoder.Encode(line)
+}
+
+// NoProgress discards progress events.
+type NoProgress struct{}
+
+func (NoProgress) Observe(domain.ProgressEvent) {}
@@ -0,0 +1,40 @@
+package ui
+
+import (
+	"sort"
+	"strconv"
+)
+
+// SortVersionsDescending sorts version tags newest first, comparing runs of
+// digits numerically so that 1.10.0 sorts above 1.9.0.
+func SortVersionsDescending(tags []string) {
+	sort.SliceStable(tags, func(i, j int) bool {
+		return naturalLess(tags[j], tags[i])
+	})
+}
+
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		ra, rb := leadingRun(a), leadingRun(b)
+		na, errA := strconv.Atoi(ra)
+		nb, errB := strconv.Atoi(rb)
+		switch {
+		case errA == nil && errB == nil && na != nb:
+			return na < nb
+		case (errA != nil || errB != nil) && ra != rb:
+			return ra < rb
+		}
+		a, b = a[len(ra):], b[len(rb):]
+	}
+	return len(a) < len(b)
+}
+
+// leadingRun returns the leading run of digits or of non-digits of s.
+func leadingRun(s string) string {
+	digit := s[0] >= '0' && s[0] <= '9'
+	i := 1
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9') == digit {
+		i++
+	}
+	return s[:i]
+}
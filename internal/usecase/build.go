@@ -0,0 +1,163 @@
+package usecase
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"deployer/internal/domain"
+)
+
+// buildTemplateData is available to build_args and labels values, e.g.
+// "{{.Version}}" or "{{.GitSHA}}".
+type buildTemplateData struct {
+	Service     string
+	Image       string
+	Version     string
+	GitSHA      string
+	GitShortSHA string
+}
+
+// buildOptions assembles the docker build of a service, expanding templates
+// in its build arguments and labels and adding the OCI image labels.
+// Services with platforms are built with buildx and pushed straight to the
+// registry.
+func (d *DeploymentService) buildOptions(serviceConfig domain.DeployConfig, version string, registry domain.RegistryConfig) (domain.BuildOptions, error) {
+	options := domain.BuildOptions{
+		Image:      fmt.Sprintf("%s:%s", serviceConfig.ImageName, version),
+		Context:    serviceConfig.BuildPath,
+		Dockerfile: serviceConfig.Dockerfile,
+		Target:     serviceConfig.Target,
+		NoCache:    serviceConfig.NoCache,
+		Pull:       serviceConfig.Pull,
+		Secrets:    serviceConfig.Secrets,
+		Platforms:  serviceConfig.Platforms,
+		CacheFrom:  append([]string(nil), serviceConfig.CacheFrom...),
+		CacheTo:    serviceConfig.CacheTo,
+	}
+	if len(options.Platforms) > 0 {
+		options.Image = fmt.Sprintf("%s/%s:%s", registry.Host, serviceConfig.ImageName, version)
+		options.Push = true
+	}
+	if options.Context == "" {
+		return options, nil
+	}
+
+	// Images pushed to the registry carry their layer cache, so that the
+	// next build can reuse the layers of the previously deployed version.
+	if serviceConfig.Transfer != transferSSH && !serviceConfig.NoCache {
+		options.InlineCache = true
+		if previous := d.cacheVersion(serviceConfig, version); previous != "" {
+			cache := fmt.Sprintf("%s/%s:%s", registry.Host, serviceConfig.ImageName, previous)
+			d.logger.Info("Using %s as build cache", cache)
+			options.CacheFrom = append(options.CacheFrom, cache)
+		}
+	}
+
+	revision, err := d.sourceControl.Revision(serviceConfig.BuildPath)
+	if err != nil {
+		d.logger.Warning("Unable to determine git revision: %v", err)
+	}
+	data := buildTemplateData{
+		Service: serviceConfig.ServiceName,
+		Image:   serviceConfig.ImageName,
+		Version: version,
+		GitSHA:  revision,
+	}
+	data.GitShortSHA = revision
+	if len(revision) > 12 {
+		data.GitShortSHA = revision[:12]
+	}
+
+	if options.BuildArgs, err = expandValues("build_args", serviceConfig.BuildArgs, data); err != nil {
+		return options, err
+	}
+
+	labels, err := expandValues("labels", serviceConfig.Labels, data)
+	if err != nil {
+		return options, err
+	}
+	options.Labels = map[string]string{
+		versionLabel:                       version,
+		"org.opencontainers.image.created": time.Now().UTC().Format(time.RFC3339),
+	}
+	if revision != "" {
+		options.Labels["org.opencontainers.image.revision"] = revision
+	}
+	for key, value := range labels {
+		options.Labels[key] = value
+	}
+
+	return options, nil
+}
+
+// cacheVersion returns the version whose image seeds the build cache: the
+// previously deployed one or, without deployment history, the highest
+// release among the registry tags of a service with semver or calver
+// versioning.
+func (d *DeploymentService) cacheVersion(serviceConfig domain.DeployConfig, version string) string {
+	if previous := d.previousVersion(serviceConfig.ServiceName, version, nil); previous != "" {
+		return previous
+	}
+	policy := serviceConfig.Versioning
+	if d.registry == nil || (policy != versioningSemver && policy != versioningCalver) {
+		return ""
+	}
+
+	tags, err := d.registry.ListTags(serviceConfig.ImageName)
+	if err != nil {
+		d.logger.Warning("Unable to list registry tags of %s: %v", serviceConfig.ServiceName, err)
+		return ""
+	}
+	var latest *parsedVersion
+	var cache string
+	for _, tag := range tags {
+		parsed, err := parseVersion(policy, tag)
+		if tag == version || err != nil || parsed.prerelease != "" || parsed.distance > 0 {
+			continue
+		}
+		if latest == nil || parsed.compare(*latest) > 0 {
+			latest, cache = &parsed, tag
+		}
+	}
+	return cache
+}
+
+// usesRegistryCache tells whether building a service pulls or pushes build
+// cache from the registry, which needs the registry login.
+func usesRegistryCache(serviceConfig domain.DeployConfig) bool {
+	if serviceConfig.BuildPath == "" || serviceConfig.NoCache {
+		return false
+	}
+	if serviceConfig.Transfer != transferSSH {
+		return true
+	}
+	for _, cache := range append(append([]string(nil), serviceConfig.CacheFrom...), serviceConfig.CacheTo...) {
+		if !strings.HasPrefix(cache, "type=") || strings.HasPrefix(cache, "type=registry") {
+			return true
+		}
+	}
+	return false
+}
+
+func expandValues(field string, values map[string]string, data buildTemplateData) (map[string]string, error) {
+	expanded := make(map[string]string, len(values))
+	for key, value := range values {
+		if !strings.Contains(value, "{{") {
+			expanded[key] = value
+			continue
+		}
+
+		tmpl, err := template.New(key).Option("missingkey=error").Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template in %s '%s': %w", field, key, err)
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, data); err != nil {
+			return nil, fmt.Errorf("invalid template in %s '%s': %w", field, key, err)
+		}
+		expanded[key] = b.String()
+	}
+	return expanded, nil
+}
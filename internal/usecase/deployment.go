@@ -3,94 +3,311 @@ package usecase
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"deployer/internal/domain"
 )
 
 type DeploymentService struct {
 	dockerService domain.DockerService
+	remoteDocker  domain.RemoteDockerService
+	registry      domain.RegistryService
 	sshService    domain.SSHService
-	logger        domain.Logger
+	shellService  domain.ShellService
+	sourceControl domain.SourceControl
+	runStore      domain.RunStore
+	lockService   domain.LockService
+	recorder      domain.PlanRecorder
+	notifiers     []domain.Notifier
+	deploymentLog domain.DeploymentLog
+	logger        *progressLogger
+
+	platform *detectedPlatform
+
+	progress domain.ProgressObserver
+	// run is the run deployed by the copy of the service made for it.
+	run *runTracker
 }
 
-func NewDeploymentService(dockerService domain.DockerService, sshService domain.SSHService, logger domain.Logger) *DeploymentService {
-	return &DeploymentService{
+func NewDeploymentService(dockerService domain.DockerService, remoteDocker domain.RemoteDockerService, registry domain.RegistryService, sshService domain.SSHService, shellService domain.ShellService, sourceControl domain.SourceControl, runStore domain.RunStore, lockService domain.LockService, logger domain.FieldLogger) *DeploymentService {
+	d := &DeploymentService{
 		dockerService: dockerService,
+		remoteDocker:  remoteDocker,
+		registry:      registry,
 		sshService:    sshService,
-		logger:        logger,
+		shellService:  shellService,
+		sourceControl: sourceControl,
+		runStore:      runStore,
+		lockService:   lockService,
+		platform:      &detectedPlatform{},
 	}
+	d.logger = &progressLogger{FieldLogger: logger, service: d}
+	return d
+}
+
+// withFields returns a copy of the service whose logger attaches fields to
+// its entries. The copy shares everything else with d, so that the steps of
+// services deployed concurrently each log under their own service.
+func (d *DeploymentService) withFields(fields map[string]string) *DeploymentService {
+	scoped := *d
+	scoped.logger = d.logger.with(fields)
+	return &scoped
+}
+
+// withRun returns a copy of the service deploying run, whose log entries
+// carry fields and whose progress events carry the run ID. The copies made
+// from it for each service keep the run.
+func (d *DeploymentService) withRun(run *runTracker, fields map[string]string) *DeploymentService {
+	scoped := d.withFields(fields)
+	scoped.run = run
+	scoped.logger.service = scoped
+	return scoped
+}
+
+// SetDeploymentLog makes every deployment, except dry runs, capture its
+// transcript in a log file named by its run ID.
+func (d *DeploymentService) SetDeploymentLog(deploymentLog domain.DeploymentLog) {
+	d.deploymentLog = deploymentLog
+}
+
+// SetRecorder attributes the commands recorded into a dry-run plan to the
+// service and step issuing them.
+func (d *DeploymentService) SetRecorder(recorder domain.PlanRecorder) {
+	d.recorder = recorder
+}
+
+func (d *DeploymentService) beginStep(service, name string) {
+	if d.recorder != nil {
+		d.recorder.BeginStep(service, name)
+	}
+}
+
+type step struct {
+	name       string
+	kind       string
+	fn         func() error
+	remote     bool
+	needsLogin bool
+	// runArgs are the docker run arguments of a run step, checked by the
+	// preflight phase.
+	runArgs string
+}
+
+// StepError reports which pipeline step a deployment failed in.
+type StepError struct {
+	Step string
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("step '%s' failed: %v", e.Step, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
 }
 
 func (d *DeploymentService) Deploy(request domain.DeploymentRequest, config *domain.Config) error {
-	serviceConfig, exists := config.Services[request.ServiceName]
-	if !exists {
-		return fmt.Errorf("service '%s' not found in config", request.ServiceName)
+	if request.ResumeRunID == "" {
+		if request.Bump != "" {
+			if err := d.bumpVersion(&request, config); err != nil {
+				return err
+			}
+		} else if request.Version == "" {
+			if err := d.resolveVersion(&request, config); err != nil {
+				return err
+			}
+		}
+		if err := d.checkVersionPolicy(request, config); err != nil {
+			return err
+		}
+		if err := d.checkSourceTree(request, config); err != nil {
+			return err
+		}
+	}
+
+	run, err := d.startRun(&request, config)
+	if err != nil {
+		return err
+	}
+	// The rest of the deployment logs through a copy of the service
+	// attaching the run to every entry.
+	d = d.withRun(run, map[string]string{
+		domain.LogRunID:   run.id(),
+		domain.LogVersion: request.Version,
+		domain.LogHost:    config.SSH.Host,
+	})
+
+	if d.deploymentLog != nil && !request.DryRun {
+		path, err := d.deploymentLog.Start(run.id())
+		if err != nil {
+			d.logger.Warning("Deployment log disabled: %v", err)
+		} else {
+			d.logger.Debug("Deploying %s version %s as %s", strings.Join(request.ServiceNames, ", "), request.Version, request.Operator)
+			if request.ResumeRunID != "" {
+				d.logger.Debug("Resuming run %s", request.ResumeRunID)
+			}
+			defer func() {
+				d.logger.Info("Deployment log: %s", path)
+				d.deploymentLog.Close()
+			}()
+		}
+	}
+
+	// A deployment failing its checks has not started: it is neither
+	// announced nor does it take the locks.
+	prepared, err := d.prepare(request, config, run)
+	notify := err == nil && !request.DryRun && len(d.notifiers) > 0
+	var started domain.DeploymentEvent
+	var rollback bool
+	if notify {
+		started, rollback = d.startedEvent(request, config, run.id())
+		d.notify(started)
 	}
 
-	if request.BuildPathOverride != "" {
-		serviceConfig.BuildPath = request.BuildPathOverride
+	if err == nil {
+		var release func()
+		release, err = d.acquireLocks(request, config, run)
+		if err == nil {
+			if len(prepared.order) > 1 {
+				err = d.deployMany(request, config, run, prepared)
+			} else {
+				err = d.deployService(request, config, run, prepared)
+			}
+			release()
+		}
 	}
 
-	steps := []struct {
-		name string
-		fn   func() error
-	}{
-		{"Building Docker image", func() error { return d.buildImage(serviceConfig, request.Version) }},
-		{"Tagging image for registry", func() error { return d.tagImage(serviceConfig, request.Version, config.Registry) }},
-		{"Logging into registry", func() error { return d.loginRegistry(config.Registry) }},
-		{"Pushing image to registry", func() error { return d.pushImage(serviceConfig, request.Version, config.Registry) }},
-		{"Connecting to remote server", func() error { return d.sshService.Connect(config.SSH) }},
-		{"Pulling image on remote", func() error { return d.pullImageRemote(serviceConfig, request.Version, config) }},
-		{"Stopping existing container", func() error { return d.stopContainer(serviceConfig.ContainerName) }},
-		{"Removing existing container", func() error { return d.removeContainer(serviceConfig.ContainerName) }},
-		{"Running new container", func() error { return d.runContainer(serviceConfig, request.Version, config.Registry) }},
-		{"Verifying container mounts", func() error { return d.checkContainerStatus(serviceConfig.ContainerName, serviceConfig.HealthTimeout) }},
+	run.finish(err)
+	if err != nil {
+		d.logger.Debug("Deployment failed: %v", err)
+	}
+	if notify {
+		d.notify(outcomeEvent(started, rollback, err))
 	}
+	return err
+}
 
+// preparedDeployment is a deployment whose checks passed: the services in
+// deployment order, each with its config, its pipeline and the copy of the
+// deployment service logging for it.
+type preparedDeployment struct {
+	order     []string
+	services  map[string]*DeploymentService
+	configs   map[string]domain.DeployConfig
+	pipelines map[string][]step
+}
+
+// prepare builds the pipelines of the requested services and runs the
+// checks that can stop a deployment before anything is changed: preflight,
+// whether pushed tags are free and whether resumed images are unchanged.
+func (d *DeploymentService) prepare(request domain.DeploymentRequest, config *domain.Config, run *runTracker) (*preparedDeployment, error) {
+	order, err := deploymentOrder(request.ServiceNames, config.Services)
+	if err != nil {
+		return nil, err
+	}
+	if len(order) > 1 {
+		d.logger.Info("Deployment order: %s", strings.Join(order, " -> "))
+	}
+
+	prepared := &preparedDeployment{
+		order:     order,
+		services:  make(map[string]*DeploymentService, len(order)),
+		configs:   make(map[string]domain.DeployConfig, len(order)),
+		pipelines: make(map[string][]step, len(order)),
+	}
+	for _, name := range order {
+		serviceConfig := config.Services[name]
+		if request.BuildPathOverride != "" && len(order) == 1 {
+			serviceConfig.BuildPath = request.BuildPathOverride
+		}
+		// Each service runs on its own copy of the deployment service,
+		// logging with the service attached, even while services publish
+		// concurrently.
+		service := d.withFields(map[string]string{domain.LogService: name})
+		steps, err := service.pipelineSteps(serviceConfig, request, config, run)
+		if err != nil {
+			return nil, err
+		}
+		if steps, err = run.filter(name, steps); err != nil {
+			return nil, err
+		}
+		prepared.services[name], prepared.configs[name], prepared.pipelines[name] = service, serviceConfig, steps
+	}
+
+	if err := d.preflight(request, config, prepared.pipelines); err != nil {
+		return nil, err
+	}
+	for _, name := range order {
+		if err := d.checkTagAvailable(prepared.configs[name], request, prepared.pipelines[name]); err != nil {
+			return nil, err
+		}
+		if err := d.checkResumedDigest(prepared.configs[name], request, prepared.pipelines[name], run); err != nil {
+			return nil, err
+		}
+	}
+	return prepared, nil
+}
+
+func (d *DeploymentService) deployService(request domain.DeploymentRequest, config *domain.Config, run *runTracker, prepared *preparedDeployment) error {
+	name := prepared.order[0]
+	d, serviceConfig := prepared.services[name], prepared.configs[name]
+	steps := run.track(name, d.withSession(prepared.pipelines[name], config))
+
+	env := hookEnvironment(serviceConfig, request.Version, config)
+	if err := d.runSteps(name, steps); err != nil {
+		d.runOutcomeHooks("on_failure", serviceConfig.Hooks.OnFailure, failureEnvironment(env, err), config)
+		return err
+	}
+
+	d.retainImages(serviceConfig, request, config, steps)
+	d.runOutcomeHooks("on_success", serviceConfig.Hooks.OnSuccess, env, config)
+	return nil
+}
+
+// runSteps runs the steps of a service in order, on the copy of the
+// deployment service logging for that service. Each step logs with its name
+// attached, and the failing step stays attached to the log entries that
+// follow.
+func (d *DeploymentService) runSteps(service string, steps []step) error {
+	serviceLogger := d.logger
 	for i, step := range steps {
-		progress := int(float64(i) / float64(len(steps)) * 100)
-		d.showProgressBar(progress)
+		d.beginStep(service, step.name)
+		d.logger = serviceLogger.with(map[string]string{domain.LogStep: step.name})
+		if err := d.refreshLocks(); err != nil {
+			return &StepError{Step: step.name, Err: err}
+		}
+		d.publishStep(domain.ProgressStepStarted, service, step.name, i, len(steps), 0, nil)
 		d.logger.Info("[%d/%d] %s", i+1, len(steps), step.name)
+		started := time.Now()
 		if err := step.fn(); err != nil {
-			return fmt.Errorf("step '%s' failed: %w", step.name, err)
+			d.logger.Debug("Step '%s' failed after %s", step.name, time.Since(started).Round(time.Millisecond))
+			d.publishStep(domain.ProgressStepFailed, service, step.name, i, len(steps), time.Since(started), err)
+			return &StepError{Step: step.name, Err: err}
 		}
-		progress = int(float64(i+1) / float64(len(steps)) * 100)
-		d.showProgressBar(progress)
+		d.logger.Debug("Step '%s' took %s", step.name, time.Since(started).Round(time.Millisecond))
+		d.publishStep(domain.ProgressStepFinished, service, step.name, i, len(steps), time.Since(started), nil)
 		d.logger.Success("[%d/%d] COMPLETED: %s", i+1, len(steps), step.name)
 	}
+	d.logger = serviceLogger
 
 	return nil
 }
 
-func (d *DeploymentService) showProgressBar(progress int) {
-	const (
-		width = 50
-		green = "\033[32m"
-		blue  = "\033[34m"
-		reset = "\033[0m"
-		bold  = "\033[1m"
-	)
-	
-	filled := int(float64(width) * float64(progress) / 100.0)
-	filledBar := strings.Repeat("█", filled)
-	emptyBar := strings.Repeat("░", width-filled)
-	
-	var color string
-	if progress == 100 {
-		color = green
-	} else {
-		color = blue
+func (d *DeploymentService) buildImage(serviceConfig domain.DeployConfig, request domain.DeploymentRequest, registry domain.RegistryConfig, run *runTracker) error {
+	options, err := d.buildOptions(serviceConfig, request.Version, registry)
+	if err != nil {
+		return err
 	}
-	
-	fmt.Printf("\r%s%s[%s%s%s%s] %s%d%%%s%s", 
-		bold, color, green, filledBar, reset, emptyBar, bold, progress, reset, reset)
-	if progress == 100 {
-		fmt.Println()
+	if err := d.dockerService.BuildImage(options); err != nil {
+		return err
 	}
-}
 
-func (d *DeploymentService) buildImage(serviceConfig domain.DeployConfig, version string) error {
-	return d.dockerService.BuildImage(serviceConfig.ImageName, version, serviceConfig.BuildPath)
+	// Multi-platform builds push the manifest list as part of the build.
+	if options.Push && !request.DryRun {
+		d.recordDigest(serviceConfig, request.Version, options.Image, run)
+	}
+	return nil
 }
 
 func (d *DeploymentService) tagImage(serviceConfig domain.DeployConfig, version string, registry domain.RegistryConfig) error {
@@ -103,81 +320,202 @@ func (d *DeploymentService) loginRegistry(registry domain.RegistryConfig) error
 	return d.dockerService.LoginRegistry(registry.Host, registry.Username, registry.Password)
 }
 
-func (d *DeploymentService) pushImage(serviceConfig domain.DeployConfig, version string, registry domain.RegistryConfig) error {
-	registryImage := fmt.Sprintf("%s/%s:%s", registry.Host, serviceConfig.ImageName, version)
-	return d.dockerService.PushImage(registryImage)
+func (d *DeploymentService) pushImage(serviceConfig domain.DeployConfig, request domain.DeploymentRequest, registry domain.RegistryConfig, run *runTracker) error {
+	registryImage := fmt.Sprintf("%s/%s:%s", registry.Host, serviceConfig.ImageName, request.Version)
+	if err := d.dockerService.PushImage(registryImage); err != nil {
+		return err
+	}
+
+	if request.DryRun {
+		return nil
+	}
+
+	d.recordDigest(serviceConfig, request.Version, registryImage, run)
+	return nil
 }
 
-func (d *DeploymentService) pullImageRemote(serviceConfig domain.DeployConfig, version string, config *domain.Config) error {
-	registryImage := fmt.Sprintf("%s/%s:%s", config.Registry.Host, serviceConfig.ImageName, version)
+// recordDigest records the registry digest of a pushed image with the run.
+func (d *DeploymentService) recordDigest(serviceConfig domain.DeployConfig, version, registryImage string, run *runTracker) {
+	digest, err := d.dockerService.ImageDigest(registryImage)
+	if err != nil && d.registry != nil {
+		digest, err = d.registry.ResolveDigest(serviceConfig.ImageName, version)
+	}
+	if err != nil {
+		d.logger.Warning("Unable to determine pushed digest: %v", err)
+	} else {
+		d.logger.Info("Pushed digest: %s", digest)
+	}
+	run.setImage(serviceConfig.ServiceName, registryImage, digest)
+}
+
+// pullImageRemote pulls the image by its registry digest, so that the server
+// runs exactly the pushed bits even if the tag is pushed again meanwhile, and
+// tags it with the version for readability. Without a known digest the tag is
+// pulled.
+func (d *DeploymentService) pullImageRemote(serviceConfig domain.DeployConfig, request domain.DeploymentRequest, config *domain.Config, run *runTracker) error {
+	registryImage := fmt.Sprintf("%s/%s:%s", config.Registry.Host, serviceConfig.ImageName, request.Version)
+
+	digest := run.digest(serviceConfig.ServiceName)
+	if digest == "" && !request.DryRun && d.registry != nil {
+		resolved, err := d.registry.ResolveDigest(serviceConfig.ImageName, request.Version)
+		if err != nil {
+			d.logger.Warning("Unable to resolve digest of %s, deploying by tag: %v", registryImage, err)
+		}
+		digest = resolved
+	}
+
+	d.checkPlatform(serviceConfig, fmt.Sprintf("%s:%s", serviceConfig.ImageName, request.Version))
 
-	commands := []string{
-		fmt.Sprintf("docker login %s -u %s -p %s", config.Registry.Host, config.Registry.Username, config.Registry.Password),
-		fmt.Sprintf("docker pull %s", registryImage),
+	reference := registryImage
+	if digest != "" {
+		reference = fmt.Sprintf("%s/%s@%s", config.Registry.Host, serviceConfig.ImageName, digest)
+		run.setImage(serviceConfig.ServiceName, registryImage, digest)
 	}
 
-	for _, cmd := range commands {
-		if err := d.sshService.RunCommand(cmd); err != nil {
-			return fmt.Errorf("remote command failed '%s': %w", cmd, err)
+	if err := d.remoteDocker.Login(config.Registry); err != nil {
+		return err
+	}
+	if err := d.remoteDocker.PullImage(reference); err != nil {
+		return err
+	}
+	if reference != registryImage {
+		if err := d.remoteDocker.TagImage(reference, registryImage); err != nil {
+			return err
 		}
 	}
 
-	d.logger.Info("Image pulled on remote: %s", registryImage)
+	d.logger.Info("Image pulled on remote: %s", reference)
 	return nil
 }
 
+// imageReference returns the image the container is run from: the pinned
+// digest reference when the digest is known, otherwise the tag.
+func imageReference(serviceConfig domain.DeployConfig, version string, config *domain.Config, run *runTracker) string {
+	if digest := run.digest(serviceConfig.ServiceName); digest != "" && serviceConfig.Transfer != transferSSH {
+		return fmt.Sprintf("%s/%s@%s", config.Registry.Host, serviceConfig.ImageName, digest)
+	}
+	return deployedImage(serviceConfig, version, config.Registry)
+}
+
 func (d *DeploymentService) stopContainer(containerName string) error {
-	cmd := fmt.Sprintf("docker stop %s || true", containerName)
-	if err := d.sshService.RunCommand(cmd); err != nil {
-		return fmt.Errorf("failed to stop container: %w", err)
+	if err := d.remoteDocker.StopContainer(containerName); err != nil {
+		return err
 	}
 	d.logger.Info("Container stopped: %s", containerName)
 	return nil
 }
 
 func (d *DeploymentService) removeContainer(containerName string) error {
-	cmd := fmt.Sprintf("docker rm %s || true", containerName)
-	if err := d.sshService.RunCommand(cmd); err != nil {
-		return fmt.Errorf("failed to remove container: %w", err)
+	if err := d.remoteDocker.RemoveContainer(containerName); err != nil {
+		return err
 	}
 	d.logger.Info("Container removed: %s", containerName)
 	return nil
 }
 
-func (d *DeploymentService) runContainer(serviceConfig domain.DeployConfig, version string, registry domain.RegistryConfig) error {
-	registryImage := fmt.Sprintf("%s/%s:%s", registry.Host, serviceConfig.ImageName, version)
-
-	cmd := fmt.Sprintf("docker run -d --name %s %s %s",
-		serviceConfig.ContainerName,
-		serviceConfig.DockerRunArgs,
-		registryImage)
+func (d *DeploymentService) runContainer(serviceConfig domain.DeployConfig, def domain.PipelineStep, version string, config *domain.Config, run *runTracker) error {
+	spec := domain.ContainerSpec{
+		Name:    serviceConfig.ContainerName,
+		Image:   imageReference(serviceConfig, version, config, run),
+		Args:    runArgs(serviceConfig, def),
+		Command: def.Command,
+	}
 
-	if err := d.sshService.RunCommand(cmd); err != nil {
-		return fmt.Errorf("failed to run container: %w", err)
+	if err := d.remoteDocker.RunContainer(spec); err != nil {
+		return err
 	}
 
-	d.logger.Info("Container started: %s", serviceConfig.ContainerName)
+	d.logger.Info("Container started: %s (%s)", serviceConfig.ContainerName, spec.Image)
 	return nil
 }
 
-func (d *DeploymentService) checkContainerStatus(containerName string, healthTimeout int) error {
-	cmd := "docker ps --format 'table {{.Names}}\\t{{.Status}}\\t{{.Ports}}'"
+// runContainerOnce runs the image to completion and removes the container,
+// for services such as batch jobs that do not keep a container running.
+func (d *DeploymentService) runContainerOnce(serviceConfig domain.DeployConfig, def domain.PipelineStep, version string, config *domain.Config, run *runTracker) error {
+	spec := domain.ContainerSpec{
+		Image:   imageReference(serviceConfig, version, config, run),
+		Args:    runArgs(serviceConfig, def),
+		Command: def.Command,
+	}
 
-	output, err := d.sshService.RunCommandWithOutput(cmd)
+	output, err := d.remoteDocker.RunOnce(spec)
+	if strings.TrimSpace(output) != "" {
+		d.logger.Info("Container output:\n%s", output)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to check container status: %w", err)
+		return err
 	}
 
-	d.logger.Info("Container status:\n%s", output)
+	d.logger.Info("One-off container completed: %s", spec.Image)
+	return nil
+}
 
-	// Check container mounts
-	mountCmd := fmt.Sprintf("docker inspect %s --format='{{range .Mounts}}{{println .Source \"->\" .Destination}}{{end}}'", containerName)
-	mountOutput, err := d.sshService.RunCommandWithOutput(mountCmd)
-	if err != nil {
-		return fmt.Errorf("failed to check container mounts: %w", err)
+// runArgs returns the docker run arguments of a run step, which default to
+// the service's docker_run_args.
+func runArgs(serviceConfig domain.DeployConfig, def domain.PipelineStep) string {
+	if def.Args != "" {
+		return def.Args
 	}
+	return serviceConfig.DockerRunArgs
+}
 
-	d.logger.Info("Container mounts:\n%s", mountOutput)
+// healthPollInterval is how often verifyContainer inspects the container
+// while waiting for it to become healthy.
+const healthPollInterval = 2 * time.Second
 
-	return nil
-}
\ No newline at end of file
+// verifyContainer waits up to the service's health_timeout for the container
+// to be running and, if the image defines a healthcheck, healthy. A container
+// that exits or stays unhealthy fails the step with the tail of its logs.
+func (d *DeploymentService) verifyContainer(serviceConfig domain.DeployConfig, dryRun bool) error {
+	name := serviceConfig.ContainerName
+	timeout := time.Duration(serviceConfig.HealthTimeout) * time.Second
+	deadline := time.Now().Add(timeout)
+
+	for {
+		state, err := d.remoteDocker.InspectContainer(name)
+		if err != nil {
+			return fmt.Errorf("failed to inspect container: %w", err)
+		}
+		if dryRun {
+			return nil
+		}
+		if state == nil {
+			return fmt.Errorf("container %s does not exist", name)
+		}
+
+		if !state.Running {
+			return d.containerFailure(name, fmt.Sprintf("container %s is %s (exit code %d)", name, state.Status, state.ExitCode))
+		}
+
+		switch state.Health {
+		case "", "healthy":
+			d.logger.Info("Container status: %s %s", state.Status, state.Health)
+			d.logMounts(state)
+			return nil
+		case "unhealthy":
+			return d.containerFailure(name, fmt.Sprintf("container %s is unhealthy", name))
+		}
+
+		if time.Now().After(deadline) {
+			return d.containerFailure(name, fmt.Sprintf("container %s did not become healthy within %s (health: %s)", name, timeout, state.Health))
+		}
+		d.logger.Info("Waiting for container %s to become healthy (health: %s)", name, state.Health)
+		time.Sleep(healthPollInterval)
+	}
+}
+
+func (d *DeploymentService) logMounts(state *domain.ContainerState) {
+	var mounts []string
+	for _, mount := range state.Mounts {
+		mounts = append(mounts, fmt.Sprintf("%s -> %s", mount.Source, mount.Destination))
+	}
+	d.logger.Info("Container mounts:\n%s", strings.Join(mounts, "\n"))
+}
+
+func (d *DeploymentService) containerFailure(name, reason string) error {
+	logs, err := d.remoteDocker.ContainerLogs(name, 20)
+	if err != nil || strings.TrimSpace(logs) == "" {
+		return fmt.Errorf("%s", reason)
+	}
+	return fmt.Errorf("%s, last log lines:\n%s", reason, strings.TrimRight(logs, "\n"))
+}
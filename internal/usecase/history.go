@@ -0,0 +1,152 @@
+package usecase
+
+import (
+	"fmt"
+
+	"deployer/internal/domain"
+)
+
+// versionLabel is the image label carrying the version an image was built
+// as.
+const versionLabel = "org.opencontainers.image.version"
+
+// deployment is a recorded run that deployed a service.
+type deployment struct {
+	run     *domain.DeploymentRun
+	service domain.ServiceRun
+	// current tells whether it is the newest deployment of the service to
+	// its environment and host, that is what that target runs.
+	current bool
+}
+
+// deployments returns the runs recorded in the run store that deployed a
+// service, most recent first.
+func (d *DeploymentService) deployments(service string) ([]deployment, error) {
+	if d.runStore == nil {
+		return nil, nil
+	}
+	runs, err := d.runStore.List()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read deployment history: %w", err)
+	}
+
+	var deployments []deployment
+	targets := make(map[string]bool)
+	for _, run := range runs {
+		serviceRun, deployed := deployedBy(run, service)
+		if !deployed {
+			continue
+		}
+		target := run.Environment + "@" + run.Host
+		deployments = append(deployments, deployment{run: run, service: serviceRun, current: !targets[target]})
+		targets[target] = true
+	}
+	return deployments, nil
+}
+
+// deployedVersions returns the versions of a service deployed by the runs
+// recorded in the run store, most recent first and without repeats. With a
+// config, only runs to its environment and host count; runs recorded
+// without a target count for every target.
+func (d *DeploymentService) deployedVersions(service string, config *domain.Config) []string {
+	deployments, err := d.deployments(service)
+	if err != nil {
+		d.logger.Warning("%v", err)
+		return nil
+	}
+
+	var versions []string
+	seen := make(map[string]bool)
+	for _, deployment := range deployments {
+		run := deployment.run
+		if seen[run.Version] || !deployedTo(run, config) {
+			continue
+		}
+		versions = append(versions, run.Version)
+		seen[run.Version] = true
+	}
+	return versions
+}
+
+// deployedBy returns the record of a service in a run that deployed it: a
+// run that succeeded, or one in which the service got as far as its run or
+// verify step before the run failed, e.g. on another service.
+func deployedBy(run *domain.DeploymentRun, service string) (domain.ServiceRun, bool) {
+	for _, serviceRun := range run.Services {
+		if serviceRun.Name != service {
+			continue
+		}
+		if run.Status == domain.RunSucceeded {
+			return serviceRun, true
+		}
+		for _, step := range serviceRun.Steps {
+			switch {
+			case step.Kind == stepRun && step.Status == domain.StepSucceeded,
+				step.Kind == stepVerify && step.Status != domain.StepSkipped:
+				return serviceRun, true
+			}
+		}
+		break
+	}
+	return domain.ServiceRun{}, false
+}
+
+func deployedTo(run *domain.DeploymentRun, config *domain.Config) bool {
+	if config == nil {
+		return true
+	}
+	return (run.Environment == "" || run.Environment == config.Environment) &&
+		(run.Host == "" || run.Host == config.SSH.Host)
+}
+
+// previousVersion returns the most recently deployed version of a service
+// other than version, to the target of config if given.
+func (d *DeploymentService) previousVersion(service, version string, config *domain.Config) string {
+	for _, deployed := range d.deployedVersions(service, config) {
+		if deployed != version {
+			return deployed
+		}
+	}
+	return ""
+}
+
+// currentVersion returns the version of a service running on the target
+// server or, when that is unknown, the last one deployed there according to
+// the run history.
+func (d *DeploymentService) currentVersion(serviceConfig domain.DeployConfig, config *domain.Config, dryRun bool) string {
+	if version := d.runningVersion(serviceConfig, config, dryRun); version != "" {
+		return version
+	}
+	if deployed := d.deployedVersions(serviceConfig.ServiceName, config); len(deployed) > 0 {
+		return deployed[0]
+	}
+	return ""
+}
+
+// runningVersion returns the version of the service's container on the
+// target server, read from its version label or else from its image tag. It
+// is empty when there is no such container or, as in dry runs, the server is
+// not asked.
+func (d *DeploymentService) runningVersion(serviceConfig domain.DeployConfig, config *domain.Config, dryRun bool) string {
+	if dryRun || d.remoteDocker == nil || d.sshService == nil {
+		return ""
+	}
+
+	if err := d.sshService.Connect(config.SSH); err != nil {
+		d.logger.Warning("Unable to read the version running on %s: %v", config.SSH.Host, err)
+		return ""
+	}
+	state, err := d.remoteDocker.InspectContainer(serviceConfig.ContainerName)
+	if err != nil {
+		d.logger.Warning("Unable to read the version running on %s: %v", config.SSH.Host, err)
+		return ""
+	}
+	if state == nil {
+		return ""
+	}
+	if version := state.Labels[versionLabel]; version != "" {
+		return version
+	}
+	tag, _ := splitReference(state.Image)
+	return tag
+}
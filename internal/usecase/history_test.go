@@ -0,0 +1,67 @@
+package usecase
+
+import (
+	"strings"
+	"testing"
+
+	"deployer/internal/domain"
+)
+
+func TestDeployedVersionsCountsPartiallyFailedRuns(t *testing.T) {
+	store := historyStore{runs: []*domain.DeploymentRun{
+		{
+			Version:     "1.4.0",
+			Environment: "staging",
+			Status:      domain.RunSucceeded,
+			Services:    []domain.ServiceRun{{Name: "api"}},
+		},
+		{
+			Version:     "1.3.0",
+			Environment: "production",
+			Status:      domain.RunFailed,
+			Services: []domain.ServiceRun{
+				{Name: "api", Steps: []domain.StepRun{
+					{Kind: stepRun, Status: domain.StepSucceeded},
+					{Kind: stepVerify, Status: domain.StepFailed},
+				}},
+				{Name: "web", Steps: []domain.StepRun{
+					{Kind: stepRun, Status: domain.StepFailed},
+				}},
+			},
+		},
+		{
+			Version:     "1.2.1",
+			Environment: "production",
+			Status:      domain.RunFailed,
+			Services: []domain.ServiceRun{
+				{Name: "api", Steps: []domain.StepRun{
+					{Kind: stepBuild, Status: domain.StepFailed},
+				}},
+			},
+		},
+		{
+			Version:     "1.2.0",
+			Environment: "production",
+			Status:      domain.RunSucceeded,
+			Services:    []domain.ServiceRun{{Name: "api"}, {Name: "web"}},
+		},
+	}}
+	service := NewDeploymentService(nil, nil, nil, nil, nil, nil, store, nil, nil)
+	production := &domain.Config{Environment: "production"}
+
+	tests := []struct {
+		service string
+		config  *domain.Config
+		want    string
+	}{
+		{service: "api", want: "1.4.0 1.3.0 1.2.0"},
+		{service: "api", config: production, want: "1.3.0 1.2.0"},
+		{service: "web", config: production, want: "1.2.0"},
+	}
+	for _, test := range tests {
+		got := strings.Join(service.deployedVersions(test.service, test.config), " ")
+		if got != test.want {
+			t.Errorf("deployedVersions(%s) = %s, want %s", test.service, got, test.want)
+		}
+	}
+}
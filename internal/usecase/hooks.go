@@ -0,0 +1,136 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"deployer/internal/domain"
+	"deployer/pkg/shellwords"
+)
+
+// hookEnvironment describes the deployment to hook commands.
+func hookEnvironment(serviceConfig domain.DeployConfig, version string, config *domain.Config) map[string]string {
+	return map[string]string{
+		"DEPLOYER_SERVICE":   serviceConfig.ServiceName,
+		"DEPLOYER_VERSION":   version,
+		"DEPLOYER_IMAGE":     deployedImage(serviceConfig, version, config.Registry),
+		"DEPLOYER_CONTAINER": serviceConfig.ContainerName,
+		"DEPLOYER_HOST":      config.SSH.Host,
+	}
+}
+
+// failureEnvironment extends env with the failing step and error message for
+// on_failure hooks.
+func failureEnvironment(env map[string]string, err error) map[string]string {
+	failed := make(map[string]string, len(env)+2)
+	for key, value := range env {
+		failed[key] = value
+	}
+
+	var stepErr *StepError
+	if errors.As(err, &stepErr) {
+		failed["DEPLOYER_FAILED_STEP"] = stepErr.Step
+	}
+	failed["DEPLOYER_ERROR"] = err.Error()
+	return failed
+}
+
+// appendHookStep adds a pipeline step running the hooks of a stage, if any are
+// configured. A failing hook fails the deployment.
+func (d *DeploymentService) appendHookStep(steps []step, stage string, hooks []domain.HookConfig, env map[string]string, config *domain.Config) []step {
+	if len(hooks) == 0 {
+		return steps
+	}
+
+	// A step with remote hooks needs the SSH connection, which keeps it out
+	// of the concurrent local phase of a multi-service deployment.
+	remote := false
+	for _, hook := range hooks {
+		remote = remote || hook.Remote
+	}
+	return append(steps, step{
+		name:   fmt.Sprintf("Running %s hooks", stage),
+		kind:   stage,
+		fn:     func() error { return d.runHooks(stage, hooks, env, config) },
+		remote: remote,
+	})
+}
+
+// runOutcomeHooks runs on_success and on_failure hooks. Their errors are only
+// logged since the outcome of the deployment is already decided.
+func (d *DeploymentService) runOutcomeHooks(stage string, hooks []domain.HookConfig, env map[string]string, config *domain.Config) {
+	if len(hooks) == 0 {
+		return
+	}
+
+	d.logger.Info("Running %s hooks", stage)
+	d.beginStep(env["DEPLOYER_SERVICE"], fmt.Sprintf("Running %s hooks", stage))
+	if err := d.runHooks(stage, hooks, env, config); err != nil {
+		d.logger.Warning("%v", err)
+	}
+}
+
+func (d *DeploymentService) runHooks(stage string, hooks []domain.HookConfig, env map[string]string, config *domain.Config) error {
+	hookEnv := make(map[string]string, len(env)+1)
+	for key, value := range env {
+		hookEnv[key] = value
+	}
+	hookEnv["DEPLOYER_HOOK"] = stage
+
+	connected := false
+	for _, hook := range hooks {
+		if hook.Remote && !connected {
+			if err := d.sshService.Connect(config.SSH); err != nil {
+				return fmt.Errorf("%s hook could not connect to remote server: %w", stage, err)
+			}
+			connected = true
+		}
+
+		if err := d.runShell(hook.Command, hook.Remote, hookEnv); err != nil {
+			return fmt.Errorf("%s hook failed: %w", stage, err)
+		}
+	}
+
+	return nil
+}
+
+// runShell runs command through the local shell, or on the connected remote
+// server, with env exported to it.
+func (d *DeploymentService) runShell(command string, remote bool, env map[string]string) error {
+	if !remote {
+		d.logger.Info("Local command: %s", command)
+		if err := d.shellService.RunLocal(command, env); err != nil {
+			return fmt.Errorf("'%s': %w", command, err)
+		}
+		return nil
+	}
+
+	output, err := d.sshService.RunCommandWithOutput(remoteHookCommand(command, env))
+	if strings.TrimSpace(output) != "" {
+		d.logger.Info("Command output:\n%s", output)
+	}
+	if err != nil {
+		return fmt.Errorf("'%s' failed on remote: %w", command, err)
+	}
+
+	return nil
+}
+
+// remoteHookCommand prefixes command with exports of env, since most SSH
+// servers refuse environment variables sent through the session.
+func remoteHookCommand(command string, env map[string]string) string {
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	exports := make([]string, 0, len(keys))
+	for _, key := range keys {
+		exports = append(exports, fmt.Sprintf("%s=%s", key, shellwords.Quote(env[key])))
+	}
+
+	return fmt.Sprintf("export %s; %s", strings.Join(exports, " "), command)
+}
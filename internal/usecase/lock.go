@@ -0,0 +1,87 @@
+package usecase
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"deployer/internal/domain"
+)
+
+// hostLockName is the lock taken for every deployment when locks are scoped
+// to the whole host.
+const hostLockName = "host"
+
+// acquireLocks takes the deployment locks for the services of a request on
+// the target server, so that two deployments cannot interleave their steps.
+// The returned function releases them. The run keeps the held locks, so
+// that the steps of each service refresh them.
+func (d *DeploymentService) acquireLocks(request domain.DeploymentRequest, config *domain.Config, run *runTracker) (func(), error) {
+	if config.Lock.Disabled || d.lockService == nil {
+		return func() {}, nil
+	}
+
+	names := []string{hostLockName}
+	if config.Lock.Scope != "host" {
+		names = append([]string(nil), request.ServiceNames...)
+		sort.Strings(names)
+	}
+
+	d.beginStep("", "Acquiring deployment lock")
+	if err := d.sshService.Connect(config.SSH); err != nil {
+		return nil, fmt.Errorf("unable to connect to acquire deployment lock: %w", err)
+	}
+
+	runID := run.id()
+	ttl := time.Duration(config.Lock.TTLMinutes) * time.Minute
+	held := &heldLocks{id: runID, ttl: ttl, refreshed: time.Now()}
+	release := func() {
+		run.locks = nil
+		d.beginStep("", "Releasing deployment lock")
+		for _, name := range held.names {
+			if err := d.lockService.Release(name, runID); err != nil {
+				d.logger.Warning("%v", err)
+			}
+		}
+	}
+
+	for _, name := range names {
+		if err := d.lockService.Acquire(name, runID, ttl); err != nil {
+			release()
+			return nil, err
+		}
+		held.names = append(held.names, name)
+	}
+
+	run.locks = held
+	return release, nil
+}
+
+// heldLocks are the deployment locks taken by the running deployment.
+type heldLocks struct {
+	names     []string
+	id        string
+	ttl       time.Duration
+	refreshed time.Time
+}
+
+// refreshLocks pushes back the expiry of the held locks once a quarter of
+// their TTL has passed since the last refresh. It runs between steps, so a
+// single step running longer than the TTL can still lose its lock.
+func (d *DeploymentService) refreshLocks() error {
+	if d.run == nil {
+		return nil
+	}
+	held := d.run.locks
+	if held == nil || time.Since(held.refreshed) < held.ttl/4 {
+		return nil
+	}
+
+	for _, name := range held.names {
+		if err := d.lockService.Refresh(name, held.id, held.ttl); err != nil {
+			return err
+		}
+	}
+	held.refreshed = time.Now()
+	return nil
+}
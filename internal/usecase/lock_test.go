@@ -0,0 +1,51 @@
+package usecase_test
+
+import (
+	"testing"
+
+	"deployer/internal/domain"
+	"deployer/internal/usecase"
+)
+
+// connectedSSH accepts every connection.
+type connectedSSH struct {
+	domain.SSHService
+}
+
+func (connectedSSH) Connect(config domain.SSHConfig) error { return nil }
+
+func TestDeployRefreshesLocksBetweenSteps(t *testing.T) {
+	locks := &countingLocks{}
+	shell := &localShell{}
+	service := usecase.NewDeploymentService(nil, nil, nil, connectedSSH{}, shell, nil, nil, locks, &recordingLogger{})
+
+	// Without a TTL the locks are due for a refresh before every step.
+	config := &domain.Config{
+		Preflight: domain.PreflightConfig{Disabled: true},
+		Services: map[string]domain.DeployConfig{
+			"api": {
+				ServiceName:   "api",
+				ImageName:     "api",
+				ContainerName: "api",
+				Pipeline: []domain.PipelineStep{
+					{Type: "shell", Command: "./migrate.sh"},
+					{Type: "shell", Command: "./seed.sh"},
+				},
+			},
+		},
+	}
+	request := domain.DeploymentRequest{ServiceName: "api", Version: "1.0.0", Operator: "alice"}
+	if err := service.Deploy(request, config); err != nil {
+		t.Fatalf("Deploy = %v, want nil", err)
+	}
+
+	if len(shell.commands) != 2 {
+		t.Errorf("commands run = %v, want both shell steps", shell.commands)
+	}
+	if locks.acquired != 1 || locks.released != 1 {
+		t.Errorf("locks acquired %d and released %d times, want once each", locks.acquired, locks.released)
+	}
+	if locks.refreshed != 2 {
+		t.Errorf("locks refreshed = %d, want 2, before each step", locks.refreshed)
+	}
+}
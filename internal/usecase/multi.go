@@ -0,0 +1,158 @@
+package usecase
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"deployer/internal/domain"
+)
+
+// deployMany deploys several services in one run. The local part of each
+// pipeline (build, tag, push) runs concurrently, then the remote part runs
+// one service at a time in dependency order. A failing service stops
+// everything that depends on it, while unrelated services are still
+// deployed.
+func (d *DeploymentService) deployMany(request domain.DeploymentRequest, config *domain.Config, run *runTracker, prepared *preparedDeployment) error {
+	order, services := prepared.order, prepared.services
+	localSteps := make(map[string][]step, len(order))
+	remoteSteps := make(map[string][]step, len(order))
+	needsLogin := false
+	for _, name := range order {
+		for _, s := range prepared.pipelines[name] {
+			needsLogin = needsLogin || s.needsLogin
+		}
+		local, remote := splitAtRemote(prepared.pipelines[name])
+		localSteps[name], remoteSteps[name] = run.track(name, local), run.track(name, remote)
+	}
+
+	if needsLogin {
+		d.beginStep("", "Logging into registry")
+		if err := d.loginRegistry(config.Registry); err != nil {
+			return fmt.Errorf("registry login failed: %w", err)
+		}
+	}
+
+	failed := make(map[string]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	publish := func(name string) {
+		d := services[name]
+		serviceConfig := config.Services[name]
+		serviceLogger := d.logger
+		for i, step := range localSteps[name] {
+			total := len(localSteps[name])
+			d.logger = serviceLogger.with(map[string]string{domain.LogStep: step.name})
+			d.publishStep(domain.ProgressStepStarted, name, step.name, i, total, 0, nil)
+			d.logger.Info("[%s] %s", name, step.name)
+			d.beginStep(name, step.name)
+			started := time.Now()
+			err := step.fn()
+			d.logger.Debug("[%s] Step '%s' took %s", name, step.name, time.Since(started).Round(time.Millisecond))
+			if err != nil {
+				d.publishStep(domain.ProgressStepFailed, name, step.name, i, total, time.Since(started), err)
+				err = &StepError{Step: step.name, Err: err}
+				d.logger.Error("[%s] %v", name, err)
+				mu.Lock()
+				failed[name] = err
+				mu.Unlock()
+				return
+			}
+			d.publishStep(domain.ProgressStepFinished, name, step.name, i, total, time.Since(started), nil)
+		}
+		d.logger = serviceLogger
+		d.logger.Success("[%s] Image ready: %s:%s", name, serviceConfig.ImageName, request.Version)
+	}
+
+	// Dry runs publish sequentially so that the recorded plan is
+	// deterministic.
+	for _, name := range order {
+		if request.DryRun {
+			publish(name)
+			continue
+		}
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			publish(name)
+		}(name)
+	}
+	wg.Wait()
+
+	d.beginStep("", "Connecting to remote server")
+	if err := d.sshService.Connect(config.SSH); err != nil {
+		err = &StepError{Step: "Connecting to remote server", Err: err}
+		for _, name := range order {
+			serviceConfig := config.Services[name]
+			env := hookEnvironment(serviceConfig, request.Version, config)
+			d.runOutcomeHooks("on_failure", serviceConfig.Hooks.OnFailure, failureEnvironment(env, err), config)
+		}
+		return fmt.Errorf("%v, no services were updated", err)
+	}
+
+	var updated, skipped []string
+	blocked := make(map[string]bool)
+	for i, name := range order {
+		serviceConfig := config.Services[name]
+		env := hookEnvironment(serviceConfig, request.Version, config)
+		if err, hasFailed := failed[name]; hasFailed {
+			d.runOutcomeHooks("on_failure", serviceConfig.Hooks.OnFailure, failureEnvironment(env, err), config)
+			blocked[name] = true
+			continue
+		}
+
+		if dep := blockingDependency(serviceConfig, blocked); dep != "" {
+			d.logger.Warning("[%s] Skipped: dependency '%s' was not deployed", name, dep)
+			blocked[name] = true
+			skipped = append(skipped, name)
+			continue
+		}
+
+		d.logger.Info("Deploying service %d/%d: %s", i+1, len(order), name)
+		service := services[name]
+		if err := service.runSteps(name, remoteSteps[name]); err != nil {
+			service.logger.Error("[%s] %v", name, err)
+			service.runOutcomeHooks("on_failure", serviceConfig.Hooks.OnFailure, failureEnvironment(env, err), config)
+			failed[name] = err
+			blocked[name] = true
+			continue
+		}
+		service.retainImages(serviceConfig, request, config, remoteSteps[name])
+		service.runOutcomeHooks("on_success", serviceConfig.Hooks.OnSuccess, env, config)
+		updated = append(updated, name)
+	}
+
+	if len(failed) == 0 {
+		d.logger.Success("Updated services: %s", strings.Join(updated, ", "))
+		return nil
+	}
+
+	var failures []string
+	for _, name := range order {
+		if err, hasFailed := failed[name]; hasFailed {
+			failures = append(failures, fmt.Sprintf("%s (%v)", name, err))
+		}
+	}
+
+	d.logger.Warning("Updated services: %s", listOrNone(updated))
+	d.logger.Warning("Skipped services: %s", listOrNone(skipped))
+	return fmt.Errorf("%d of %d services failed: %s; already updated: %s",
+		len(failed), len(order), strings.Join(failures, ", "), listOrNone(updated))
+}
+
+func blockingDependency(serviceConfig domain.DeployConfig, blocked map[string]bool) string {
+	for _, dep := range serviceConfig.DependsOn {
+		if blocked[dep] {
+			return dep
+		}
+	}
+	return ""
+}
+
+func listOrNone(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,83 @@
+package usecase
+
+import (
+	"errors"
+	"time"
+
+	"deployer/internal/domain"
+)
+
+// AddNotifier registers a target for the started, succeeded, failed and
+// rolled back events of deployments.
+func (d *DeploymentService) AddNotifier(notifier domain.Notifier) {
+	d.notifiers = append(d.notifiers, notifier)
+}
+
+// notify sends an event to every notifier. A failing notifier is reported
+// but never fails the deployment.
+func (d *DeploymentService) notify(event domain.DeploymentEvent) {
+	d.logger.Debug("Sending %s event to %d notifier(s)", event.Type, len(d.notifiers))
+	for _, notifier := range d.notifiers {
+		if err := notifier.Notify(event); err != nil {
+			d.logger.Warning("Notification failed: %v", err)
+		}
+	}
+}
+
+// startedEvent returns the started event of a deployment, and whether it
+// rolls back to a version deployed before the current one. Both are decided
+// on the first service.
+func (d *DeploymentService) startedEvent(request domain.DeploymentRequest, config *domain.Config, runID string) (domain.DeploymentEvent, bool) {
+	event := domain.DeploymentEvent{
+		Type:        domain.EventStarted,
+		RunID:       runID,
+		Environment: config.Environment,
+		Services:    request.ServiceNames,
+		Version:     request.Version,
+		Operator:    request.Operator,
+		Time:        time.Now(),
+	}
+	if len(request.ServiceNames) == 0 {
+		return event, false
+	}
+
+	serviceConfig := config.Services[request.ServiceNames[0]]
+	current := d.currentVersion(serviceConfig, config, request.DryRun)
+	if current == "" || current == request.Version {
+		return event, false
+	}
+	event.PreviousVersion = current
+
+	rollback := false
+	for _, version := range d.deployedVersions(serviceConfig.ServiceName, config) {
+		if version == request.Version {
+			rollback = true
+			break
+		}
+	}
+	return event, rollback
+}
+
+// outcomeEvent turns the started event into the one reporting how the
+// deployment ended.
+func outcomeEvent(started domain.DeploymentEvent, rollback bool, err error) domain.DeploymentEvent {
+	event := started
+	event.Time = time.Now()
+	event.Duration = event.Time.Sub(started.Time).Round(time.Second)
+
+	switch {
+	case err != nil:
+		event.Type = domain.EventFailed
+		event.Error = err.Error()
+		var stepErr *StepError
+		if errors.As(err, &stepErr) {
+			event.FailedStep = stepErr.Step
+			event.Error = stepErr.Err.Error()
+		}
+	case rollback:
+		event.Type = domain.EventRolledBack
+	default:
+		event.Type = domain.EventSucceeded
+	}
+	return event
+}
@@ -0,0 +1,175 @@
+package usecase_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"deployer/internal/domain"
+	"deployer/internal/infrastructure"
+	"deployer/internal/usecase"
+)
+
+// recordingLogger keeps the warnings logged during a deployment.
+type recordingLogger struct {
+	mu       sync.Mutex
+	warnings []string
+}
+
+func (l *recordingLogger) Debug(msg string, args ...interface{})     {}
+func (l *recordingLogger) Info(msg string, args ...interface{})      {}
+func (l *recordingLogger) Error(msg string, args ...interface{})     {}
+func (l *recordingLogger) Success(msg string, args ...interface{})   {}
+func (l *recordingLogger) With(map[string]string) domain.FieldLogger { return l }
+
+func (l *recordingLogger) Warning(msg string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.warnings = append(l.warnings, fmt.Sprintf(msg, args...))
+}
+
+// localShell pretends to run local commands.
+type localShell struct {
+	commands []string
+}
+
+func (s *localShell) RunLocal(command string, env map[string]string) error {
+	s.commands = append(s.commands, command)
+	return nil
+}
+
+func TestDeploySucceedsWhenWebhookFails(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{name: "server error", url: failing.URL, want: "status 500: internal error"},
+		{name: "unreachable", url: unreachable.URL, want: "request failed"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			notifier, err := infrastructure.NewWebhookNotifier([]domain.WebhookConfig{{Name: "chat", URL: test.url}})
+			if err != nil {
+				t.Fatalf("NewWebhookNotifier: %v", err)
+			}
+
+			logger := &recordingLogger{}
+			shell := &localShell{}
+			service := usecase.NewDeploymentService(nil, nil, nil, nil, shell, nil, nil, nil, logger)
+			service.AddNotifier(notifier)
+
+			config := &domain.Config{
+				Lock: domain.LockConfig{Disabled: true},
+				Services: map[string]domain.DeployConfig{
+					"api": {
+						ServiceName:   "api",
+						ImageName:     "api",
+						ContainerName: "api",
+						Pipeline:      []domain.PipelineStep{{Type: "shell", Command: "./migrate.sh"}},
+					},
+				},
+			}
+			request := domain.DeploymentRequest{ServiceName: "api", Version: "1.0.0", Operator: "alice"}
+			if err := service.Deploy(request, config); err != nil {
+				t.Fatalf("Deploy = %v, want nil despite the failing webhook", err)
+			}
+
+			if len(shell.commands) != 1 {
+				t.Errorf("commands run = %v, want the pipeline's shell step", shell.commands)
+			}
+			// Both the started and the succeeded event fail.
+			var failures []string
+			for _, warning := range logger.warnings {
+				if strings.HasPrefix(warning, "Notification failed: webhook chat: ") && strings.Contains(warning, test.want) {
+					failures = append(failures, warning)
+				}
+			}
+			if len(failures) != 2 {
+				t.Errorf("warnings = %q, want two notification failures mentioning %q", logger.warnings, test.want)
+			}
+		})
+	}
+}
+
+// existingTagRegistry reports every tag as already pushed.
+type existingTagRegistry struct {
+	domain.RegistryService
+}
+
+func (existingTagRegistry) CheckCredentials() error { return nil }
+
+func (existingTagRegistry) TagExists(repository, tag string) (bool, error) { return true, nil }
+
+// countingLocks counts the locks acquired, refreshed and released.
+type countingLocks struct {
+	domain.LockService
+	acquired  int
+	refreshed int
+	released  int
+}
+
+func (l *countingLocks) Acquire(name, id string, ttl time.Duration) error {
+	l.acquired++
+	return nil
+}
+
+func (l *countingLocks) Refresh(name, id string, ttl time.Duration) error {
+	l.refreshed++
+	return nil
+}
+
+func (l *countingLocks) Release(name, id string) error {
+	l.released++
+	return nil
+}
+
+func TestDeployFailingChecksIsNotAnnounced(t *testing.T) {
+	var requests int
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer webhook.Close()
+	notifier, err := infrastructure.NewWebhookNotifier([]domain.WebhookConfig{{Name: "chat", URL: webhook.URL}})
+	if err != nil {
+		t.Fatalf("NewWebhookNotifier: %v", err)
+	}
+
+	locks := &countingLocks{}
+	service := usecase.NewDeploymentService(nil, nil, existingTagRegistry{}, nil, &localShell{}, nil, nil, locks, &recordingLogger{})
+	service.AddNotifier(notifier)
+
+	config := &domain.Config{
+		Preflight: domain.PreflightConfig{Disabled: true},
+		Services: map[string]domain.DeployConfig{
+			"api": {
+				ServiceName:   "api",
+				ImageName:     "api",
+				ContainerName: "api",
+				Pipeline:      []domain.PipelineStep{{Type: "push"}},
+			},
+		},
+	}
+	request := domain.DeploymentRequest{ServiceName: "api", Version: "1.0.0", Operator: "alice"}
+	err = service.Deploy(request, config)
+	if err == nil || !strings.Contains(err.Error(), "already exists in the registry") {
+		t.Fatalf("Deploy = %v, want the existing tag refused", err)
+	}
+	if requests != 0 {
+		t.Errorf("webhook called %d times, want no notification for a deployment that never started", requests)
+	}
+	if locks.acquired != 0 {
+		t.Errorf("locks acquired = %d, want none", locks.acquired)
+	}
+}
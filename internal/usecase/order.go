@@ -0,0 +1,72 @@
+package usecase
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"deployer/internal/domain"
+)
+
+// deploymentOrder sorts the selected services so that every service comes
+// after the services it depends on. Dependencies that are not part of the
+// selection are assumed to be running already and do not affect the order.
+func deploymentOrder(names []string, services map[string]domain.DeployConfig) ([]string, error) {
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		if _, exists := services[name]; !exists {
+			return nil, fmt.Errorf("service '%s' not found in config", name)
+		}
+		selected[name] = true
+	}
+
+	pending := make(map[string]int, len(selected))
+	dependents := make(map[string][]string)
+	for name := range selected {
+		pending[name] = 0
+		for _, dep := range services[name].DependsOn {
+			if _, exists := services[dep]; !exists {
+				return nil, fmt.Errorf("service '%s' depends on unknown service '%s'", name, dep)
+			}
+			if !selected[dep] {
+				continue
+			}
+			pending[name]++
+			dependents[dep] = append(dependents[dep], name)
+		}
+	}
+
+	var ready []string
+	for name, count := range pending {
+		if count == 0 {
+			ready = append(ready, name)
+		}
+	}
+
+	order := make([]string, 0, len(selected))
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		name := ready[0]
+		ready = ready[1:]
+		order = append(order, name)
+		for _, dependent := range dependents[name] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	if len(order) != len(selected) {
+		var cycle []string
+		for name, count := range pending {
+			if count > 0 {
+				cycle = append(cycle, name)
+			}
+		}
+		sort.Strings(cycle)
+		return nil, fmt.Errorf("dependency cycle between services: %s", strings.Join(cycle, ", "))
+	}
+
+	return order, nil
+}
@@ -0,0 +1,211 @@
+package usecase
+
+import (
+	"fmt"
+	"time"
+
+	"deployer/internal/domain"
+)
+
+const (
+	stepBuild      = "build"
+	stepTag        = "tag"
+	stepPush       = "push"
+	stepPull       = "pull"
+	stepStop       = "stop"
+	stepRemove     = "remove"
+	stepRun        = "run"
+	stepVerify     = "verify"
+	stepWait       = "wait"
+	stepShell      = "shell"
+	stepUploadFile = "upload-file"
+	stepTransfer   = "transfer"
+)
+
+// defaultPipeline is used by services that do not define their own.
+var defaultPipeline = []domain.PipelineStep{
+	{Type: stepBuild},
+	{Type: stepTag},
+	{Type: stepPush},
+	{Type: stepPull},
+	{Type: stepStop},
+	{Type: stepRemove},
+	{Type: stepRun},
+	{Type: stepVerify},
+}
+
+// sshTransferPipeline is the default for services with "transfer": "ssh",
+// which ship the image over SSH instead of tagging, pushing and pulling it.
+var sshTransferPipeline = []domain.PipelineStep{
+	{Type: stepBuild},
+	{Type: stepTransfer},
+	{Type: stepStop},
+	{Type: stepRemove},
+	{Type: stepRun},
+	{Type: stepVerify},
+}
+
+// multiPlatformPipeline is the default for services with platforms, whose
+// build step pushes the multi-platform image itself.
+var multiPlatformPipeline = []domain.PipelineStep{
+	{Type: stepBuild},
+	{Type: stepPull},
+	{Type: stepStop},
+	{Type: stepRemove},
+	{Type: stepRun},
+	{Type: stepVerify},
+}
+
+// pipelineSteps expands the configured pipeline of a service, or the default
+// one, into runnable steps with the service hooks attached to their build,
+// push (or transfer), stop and run steps. Registry login and the SSH connection are not
+// included; see withSession.
+func (d *DeploymentService) pipelineSteps(serviceConfig domain.DeployConfig, request domain.DeploymentRequest, config *domain.Config, run *runTracker) ([]step, error) {
+	definition := serviceConfig.Pipeline
+	if len(definition) == 0 {
+		definition = defaultPipeline
+		if serviceConfig.Transfer == transferSSH {
+			definition = sshTransferPipeline
+		} else if len(serviceConfig.Platforms) > 0 {
+			definition = multiPlatformPipeline
+		}
+	}
+
+	version := request.Version
+	env := hookEnvironment(serviceConfig, version, config)
+	hooks := serviceConfig.Hooks
+
+	var steps []step
+	for i, def := range definition {
+		start := len(steps)
+		var s step
+		if serviceConfig.Transfer == transferSSH && (def.Type == stepTag || def.Type == stepPush || def.Type == stepPull) {
+			return nil, fmt.Errorf("service '%s': pipeline step %d (%s) cannot be used with transfer 'ssh', use a 'transfer' step", serviceConfig.ServiceName, i+1, def.Type)
+		}
+		if len(serviceConfig.Platforms) > 0 && (def.Type == stepTag || def.Type == stepPush) {
+			return nil, fmt.Errorf("service '%s': pipeline step %d (%s) cannot be used with platforms, the build step pushes the image", serviceConfig.ServiceName, i+1, def.Type)
+		}
+
+		switch def.Type {
+		case stepBuild:
+			steps = d.appendHookStep(steps, "pre_build", hooks.PreBuild, env, config)
+			s = step{name: "Building Docker image", fn: func() error { return d.buildImage(serviceConfig, request, config.Registry, run) }}
+			s.needsLogin = len(serviceConfig.Platforms) > 0 || usesRegistryCache(serviceConfig)
+		case stepTag:
+			s = step{name: "Tagging image for registry", fn: func() error { return d.tagImage(serviceConfig, version, config.Registry) }}
+		case stepPush:
+			s = step{name: "Pushing image to registry", fn: func() error { return d.pushImage(serviceConfig, request, config.Registry, run) }}
+			s.needsLogin = true
+		case stepPull:
+			s = step{name: "Pulling image on remote", fn: func() error { return d.pullImageRemote(serviceConfig, request, config, run) }}
+		case stepTransfer:
+			if serviceConfig.Transfer != transferSSH {
+				return nil, fmt.Errorf("service '%s': pipeline step %d (transfer) needs \"transfer\": \"ssh\"", serviceConfig.ServiceName, i+1)
+			}
+			s = step{name: "Transferring image over SSH", fn: func() error { return d.transferImage(serviceConfig, version, run, request.DryRun) }}
+		case stepStop:
+			steps = d.appendHookStep(steps, "pre_stop", hooks.PreStop, env, config)
+			s = step{name: "Stopping existing container", fn: func() error { return d.stopContainer(serviceConfig.ContainerName) }}
+		case stepRemove:
+			s = step{name: "Removing existing container", fn: func() error { return d.removeContainer(serviceConfig.ContainerName) }}
+		case stepRun:
+			if def.Once {
+				s = step{name: "Running one-off container", fn: func() error { return d.runContainerOnce(serviceConfig, def, version, config, run) }}
+			} else {
+				s = step{name: "Running new container", fn: func() error { return d.runContainer(serviceConfig, def, version, config, run) }}
+			}
+			s.runArgs = runArgs(serviceConfig, def)
+		case stepVerify:
+			s = step{name: "Verifying container health", fn: func() error {
+				return d.verifyContainer(serviceConfig, request.DryRun)
+			}}
+		case stepWait:
+			if def.Seconds <= 0 {
+				return nil, fmt.Errorf("service '%s': pipeline step %d (wait) needs a positive 'seconds'", serviceConfig.ServiceName, i+1)
+			}
+			duration := time.Duration(def.Seconds) * time.Second
+			s = step{name: fmt.Sprintf("Waiting %s", duration), fn: func() error {
+				if !request.DryRun {
+					time.Sleep(duration)
+				}
+				return nil
+			}}
+		case stepShell:
+			if def.Command == "" {
+				return nil, fmt.Errorf("service '%s': pipeline step %d (shell) needs a 'command'", serviceConfig.ServiceName, i+1)
+			}
+			command, remote := def.Command, def.Remote
+			s = step{name: fmt.Sprintf("Running %s", command), fn: func() error { return d.runShell(command, remote, env) }}
+		case stepUploadFile:
+			if def.Source == "" || def.Destination == "" {
+				return nil, fmt.Errorf("service '%s': pipeline step %d (upload-file) needs 'source' and 'destination'", serviceConfig.ServiceName, i+1)
+			}
+			source, destination := def.Source, def.Destination
+			s = step{name: fmt.Sprintf("Uploading %s", source), fn: func() error { return d.sshService.UploadFile(source, destination) }}
+		default:
+			return nil, fmt.Errorf("service '%s': unknown pipeline step type '%s'", serviceConfig.ServiceName, def.Type)
+		}
+
+		s.kind = def.Type
+		if def.Name != "" {
+			s.name = def.Name
+		}
+		steps = append(steps, s)
+
+		switch {
+		case def.Type == stepPush, def.Type == stepTransfer, def.Type == stepBuild && len(serviceConfig.Platforms) > 0:
+			steps = d.appendHookStep(steps, "post_push", hooks.PostPush, env, config)
+		case def.Type == stepRun:
+			steps = d.appendHookStep(steps, "post_start", hooks.PostStart, env, config)
+		}
+
+		// Hooks are on the same side of the pipeline as their step, or on
+		// the remote side when they run there.
+		for j := start; j < len(steps); j++ {
+			steps[j].remote = steps[j].remote || isRemoteStep(def)
+		}
+	}
+
+	return steps, nil
+}
+
+func isRemoteStep(def domain.PipelineStep) bool {
+	switch def.Type {
+	case stepPull, stepTransfer, stepStop, stepRemove, stepRun, stepVerify, stepUploadFile:
+		return true
+	case stepShell:
+		return def.Remote
+	}
+	return false
+}
+
+// withSession inserts the registry login before the first step pushing to the
+// registry and the SSH connection before the first step needing the remote
+// server.
+func (d *DeploymentService) withSession(steps []step, config *domain.Config) []step {
+	loggedIn, connected := false, false
+	session := make([]step, 0, len(steps)+2)
+	for _, s := range steps {
+		if s.needsLogin && !loggedIn {
+			session = append(session, step{name: "Logging into registry", kind: stepLogin, fn: func() error { return d.loginRegistry(config.Registry) }})
+			loggedIn = true
+		}
+		if s.remote && !connected {
+			session = append(session, step{name: "Connecting to remote server", kind: stepConnect, fn: func() error { return d.sshService.Connect(config.SSH) }})
+			connected = true
+		}
+		session = append(session, s)
+	}
+	return session
+}
+
+// splitAtRemote separates the local steps at the start of a pipeline from
+// the rest, which starts with the first step needing the remote server.
+func splitAtRemote(steps []step) ([]step, []step) {
+	for i, s := range steps {
+		if s.remote {
+			return steps[:i], steps[i:]
+		}
+	}
+	return steps, nil
+}
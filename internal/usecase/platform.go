@@ -0,0 +1,90 @@
+package usecase
+
+import (
+	"fmt"
+	"strings"
+
+	"deployer/internal/domain"
+)
+
+// unameArchitectures maps `uname -m` output to Docker platform architectures.
+var unameArchitectures = map[string]string{
+	"x86_64":  "amd64",
+	"amd64":   "amd64",
+	"aarch64": "arm64",
+	"arm64":   "arm64",
+	"armv7l":  "arm/v7",
+	"armv6l":  "arm/v6",
+	"i386":    "386",
+	"i686":    "386",
+	"ppc64le": "ppc64le",
+	"s390x":   "s390x",
+}
+
+// detectedPlatform is the platform of the target server, shared by the
+// copies of the deployment service logging for each service.
+type detectedPlatform struct {
+	name     string
+	detected bool
+}
+
+// remotePlatform returns the Docker platform of the target server, such as
+// linux/amd64, or an empty string when it cannot be determined. It is
+// detected once per deployment; remote steps run one at a time.
+func (d *DeploymentService) remotePlatform() string {
+	if d.platform.detected {
+		return d.platform.name
+	}
+	d.platform.detected = true
+
+	output, err := d.sshService.RunCommandWithOutput("uname -m")
+	if err != nil {
+		d.logger.Warning("Unable to detect the remote architecture: %v", err)
+		return ""
+	}
+	machine := strings.TrimSpace(output)
+	if machine == "" {
+		return ""
+	}
+	arch, known := unameArchitectures[machine]
+	if !known {
+		d.logger.Warning("Unknown remote architecture '%s'", machine)
+		return ""
+	}
+
+	d.platform.name = "linux/" + arch
+	d.logger.Info("Remote platform: %s", d.platform.name)
+	return d.platform.name
+}
+
+// checkPlatform warns when the image deployed to the server was not built for
+// its architecture, e.g. an arm64 image built on a laptop for an amd64
+// server. The container would fail to start with "exec format error".
+func (d *DeploymentService) checkPlatform(serviceConfig domain.DeployConfig, localImage string) {
+	remote := d.remotePlatform()
+	if remote == "" {
+		return
+	}
+
+	platforms := serviceConfig.Platforms
+	if len(platforms) == 0 {
+		info, err := d.dockerService.InspectImage(localImage)
+		if err != nil || info.Platform == "" {
+			return
+		}
+		platforms = []string{info.Platform}
+	}
+
+	for _, platform := range platforms {
+		if platform == remote || strings.HasPrefix(remote, platform+"/") {
+			return
+		}
+	}
+
+	hint := ""
+	if len(serviceConfig.Platforms) == 0 {
+		hint = fmt.Sprintf(", set \"platforms\": [\"%s\"] to build for it", remote)
+	}
+	d.logger.Warning("Image %s is built for %s but the server runs %s%s",
+		localImage, strings.Join(platforms, ", "), remote, hint)
+}
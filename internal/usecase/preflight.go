@@ -0,0 +1,336 @@
+package usecase
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"deployer/internal/domain"
+	"deployer/pkg/bytesize"
+	"deployer/pkg/shellwords"
+)
+
+// preflight checks, before anything is changed, that what the steps about to
+// run depend on is in place: the local and remote docker daemons, the build
+// files, the registry credentials, the SSH connection, free disk space and
+// the networks, containers and host ports named in docker run arguments.
+// Every problem found is reported in a single error.
+func (d *DeploymentService) preflight(request domain.DeploymentRequest, config *domain.Config, pipelines map[string][]step) error {
+	if config.Preflight.Disabled {
+		return nil
+	}
+	if request.DryRun {
+		d.logger.Info("Dry run: skipping preflight checks")
+		return nil
+	}
+
+	names := make([]string, 0, len(pipelines))
+	for name := range pipelines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	d.logger.Info("Running preflight checks")
+	var problems []string
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	builds, registry, remote := false, false, false
+	for _, name := range names {
+		for _, s := range pipelines[name] {
+			builds = builds || s.kind == stepBuild
+			registry = registry || s.needsLogin || s.kind == stepPull
+			remote = remote || s.remote
+		}
+	}
+
+	if builds {
+		if err := d.dockerService.Ping(); err != nil {
+			fail("local docker: %v", err)
+		}
+		for _, name := range names {
+			if !hasStep(pipelines[name], stepBuild) {
+				continue
+			}
+			serviceConfig := config.Services[name]
+			if request.BuildPathOverride != "" {
+				serviceConfig.BuildPath = request.BuildPathOverride
+			}
+			if err := checkBuildFiles(serviceConfig); err != nil {
+				fail("%s: %v", name, err)
+			}
+		}
+	}
+
+	if registry && d.registry != nil {
+		if err := d.registry.CheckCredentials(); err != nil {
+			fail("registry: %v", err)
+		}
+	}
+
+	if remote {
+		if err := d.sshService.Connect(config.SSH); err != nil {
+			fail("ssh: %v", err)
+		} else if err := d.remoteDocker.Ping(); err != nil {
+			fail("remote docker: %v", err)
+		} else {
+			for _, problem := range d.checkRemote(names, config, pipelines) {
+				fail("%s", problem)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("preflight checks failed:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	d.logger.Success("Preflight checks passed")
+	return nil
+}
+
+// checkBuildFiles checks that the build path and its Dockerfile exist.
+func checkBuildFiles(serviceConfig domain.DeployConfig) error {
+	if serviceConfig.BuildPath == "" {
+		return nil
+	}
+	if info, err := os.Stat(serviceConfig.BuildPath); err != nil || !info.IsDir() {
+		return fmt.Errorf("build path %s is not a directory", serviceConfig.BuildPath)
+	}
+
+	dockerfile := serviceConfig.Dockerfile
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+	if !filepath.IsAbs(dockerfile) {
+		dockerfile = filepath.Join(serviceConfig.BuildPath, dockerfile)
+	}
+	if _, err := os.Stat(dockerfile); err != nil {
+		return fmt.Errorf("dockerfile %s does not exist", dockerfile)
+	}
+	return nil
+}
+
+// checkRemote checks the disk space of the target server and what the run
+// steps of the services need there.
+func (d *DeploymentService) checkRemote(names []string, config *domain.Config, pipelines map[string][]step) []string {
+	var problems []string
+
+	if minimum := int64(config.Preflight.MinFreeDiskMB) << 20; minimum > 0 {
+		free, err := d.remoteDocker.DiskFree()
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("remote disk space: %v", err))
+		} else if free < minimum {
+			problems = append(problems, fmt.Sprintf("remote disk space: %s free, at least %s required", bytesize.Format(free), bytesize.Format(minimum)))
+		}
+	}
+
+	// Ports held by the containers this deployment replaces are released
+	// before the new ones start.
+	replaced := make(map[string]bool)
+	for _, name := range names {
+		if hasStep(pipelines[name], stepRemove) {
+			replaced[config.Services[name].ContainerName] = true
+		}
+	}
+
+	var published []domain.PublishedPort
+	listed := false
+	for _, name := range names {
+		for _, s := range pipelines[name] {
+			if s.kind != stepRun {
+				continue
+			}
+			needs, err := parseRunNeeds(s.runArgs)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: invalid docker run arguments: %v", name, err))
+				continue
+			}
+
+			for _, network := range needs.networks {
+				if exists, err := d.remoteDocker.HasNetwork(network); err != nil {
+					problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+				} else if !exists {
+					problems = append(problems, fmt.Sprintf("%s: network %s does not exist on the server", name, network))
+				}
+			}
+			for _, volume := range needs.volumes {
+				if exists, err := d.remoteDocker.HasVolume(volume); err != nil {
+					problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+				} else if !exists {
+					d.logger.Warning("%s: volume %s does not exist on the server and will be created empty", name, volume)
+				}
+			}
+			for _, container := range needs.volumesFrom {
+				if state, err := d.remoteDocker.InspectContainer(container); err != nil {
+					problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+				} else if state == nil {
+					problems = append(problems, fmt.Sprintf("%s: container %s of --volumes-from does not exist on the server", name, container))
+				}
+			}
+
+			if len(needs.ports) == 0 {
+				continue
+			}
+			if !listed {
+				if published, err = d.remoteDocker.PublishedPorts(); err != nil {
+					problems = append(problems, fmt.Sprintf("remote ports: %v", err))
+				}
+				listed = true
+			}
+			for _, port := range needs.ports {
+				for _, used := range published {
+					if !replaced[used.Container] && portsConflict(port, used) {
+						problems = append(problems, fmt.Sprintf("%s: host port %d/%s is already published by container %s", name, port.HostPort, port.Protocol, used.Container))
+						break
+					}
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// runNeeds is what a container started with some docker run arguments
+// expects to find on the server.
+type runNeeds struct {
+	networks    []string
+	volumes     []string
+	volumesFrom []string
+	ports       []domain.PublishedPort
+}
+
+// parseRunNeeds extracts the networks, named volumes, --volumes-from
+// containers and published host ports from docker run arguments. The short
+// options -p and -v also accept their value attached, as in -p8080:80.
+func parseRunNeeds(args string) (runNeeds, error) {
+	var needs runNeeds
+	words, err := shellwords.Split(args)
+	if err != nil {
+		return needs, err
+	}
+
+	for i := 0; i < len(words); i++ {
+		flag, value, hasValue := strings.Cut(words[i], "=")
+		if !strings.HasPrefix(flag, "--") {
+			flag, value, hasValue = words[i], "", false
+			if short := words[i]; len(short) > 2 && (strings.HasPrefix(short, "-p") || strings.HasPrefix(short, "-v")) {
+				flag, value, hasValue = short[:2], strings.TrimPrefix(short[2:], "="), true
+			}
+		}
+		switch flag {
+		case "--network", "--net", "-v", "--volume", "--volumes-from", "-p", "--publish":
+		default:
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(words) {
+				return needs, fmt.Errorf("option %s needs a value", flag)
+			}
+			i++
+			value = words[i]
+		}
+
+		switch flag {
+		case "--network", "--net":
+			switch {
+			case value == "bridge", value == "host", value == "none", value == "default", strings.HasPrefix(value, "container:"):
+			default:
+				needs.networks = append(needs.networks, value)
+			}
+		case "-v", "--volume":
+			// Named volumes, unlike bind mounts, do not start with a path.
+			source, _, found := strings.Cut(value, ":")
+			if found && !strings.HasPrefix(source, "/") && !strings.HasPrefix(source, ".") && !strings.HasPrefix(source, "~") {
+				needs.volumes = append(needs.volumes, source)
+			}
+		case "--volumes-from":
+			container, _, _ := strings.Cut(value, ":")
+			needs.volumesFrom = append(needs.volumesFrom, container)
+		case "-p", "--publish":
+			ports, err := parseHostPorts(value)
+			if err != nil {
+				return needs, err
+			}
+			needs.ports = append(needs.ports, ports...)
+		}
+	}
+	return needs, nil
+}
+
+// parseHostPorts returns the host ports of a -p value such as 8080:80,
+// 127.0.0.1:8080:80/udp, [::1]:8080:80 or 8000-8001:8000-8001. Ports
+// published on a random host port are left out.
+func parseHostPorts(value string) ([]domain.PublishedPort, error) {
+	spec, protocol, found := strings.Cut(value, "/")
+	if !found {
+		protocol = "tcp"
+	}
+
+	if strings.HasPrefix(spec, "[") {
+		// An IPv6 address is bracketed since it contains colons.
+		address, rest, closed := strings.Cut(spec[1:], "]")
+		parts := strings.Split(strings.TrimPrefix(rest, ":"), ":")
+		if !closed || !strings.HasPrefix(rest, ":") || len(parts) != 2 {
+			return nil, fmt.Errorf("invalid port mapping '%s'", value)
+		}
+		return publishedPorts(value, address, parts[0], protocol)
+	}
+
+	parts := strings.Split(spec, ":")
+	var ip, hostPorts string
+	switch len(parts) {
+	case 1:
+		return nil, nil
+	case 2:
+		hostPorts = parts[0]
+	case 3:
+		ip, hostPorts = parts[0], parts[1]
+	default:
+		return nil, fmt.Errorf("invalid port mapping '%s'", value)
+	}
+	return publishedPorts(value, ip, hostPorts, protocol)
+}
+
+// publishedPorts expands the host port or port range of the -p value to
+// the ports it publishes.
+func publishedPorts(value, ip, hostPorts, protocol string) ([]domain.PublishedPort, error) {
+	if hostPorts == "" {
+		return nil, nil
+	}
+
+	first, last, isRange := strings.Cut(hostPorts, "-")
+	if !isRange {
+		last = first
+	}
+	from, err1 := strconv.Atoi(first)
+	to, err2 := strconv.Atoi(last)
+	if err1 != nil || err2 != nil || from > to {
+		return nil, fmt.Errorf("invalid port mapping '%s'", value)
+	}
+
+	var ports []domain.PublishedPort
+	for port := from; port <= to; port++ {
+		ports = append(ports, domain.PublishedPort{HostIP: ip, HostPort: port, Protocol: protocol})
+	}
+	return ports, nil
+}
+
+// portsConflict reports whether two published ports would bind the same
+// host address.
+func portsConflict(a, b domain.PublishedPort) bool {
+	if a.HostPort != b.HostPort || a.Protocol != b.Protocol {
+		return false
+	}
+	return anyAddress(a.HostIP) || anyAddress(b.HostIP) || a.HostIP == b.HostIP
+}
+
+func anyAddress(ip string) bool {
+	switch strings.Trim(ip, "[]") {
+	case "", "0.0.0.0", "::":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package usecase
+
+import (
+	"reflect"
+	"testing"
+
+	"deployer/internal/domain"
+)
+
+func TestParseHostPorts(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []domain.PublishedPort
+		wantErr bool
+	}{
+		{value: "80"},
+		{value: "8080:80", want: []domain.PublishedPort{{HostPort: 8080, Protocol: "tcp"}}},
+		{value: "127.0.0.1:53:53/udp", want: []domain.PublishedPort{{HostIP: "127.0.0.1", HostPort: 53, Protocol: "udp"}}},
+		{value: "127.0.0.1::80"},
+		{value: "8000-8001:8000-8001", want: []domain.PublishedPort{{HostPort: 8000, Protocol: "tcp"}, {HostPort: 8001, Protocol: "tcp"}}},
+		{value: "[::1]:8080:80", want: []domain.PublishedPort{{HostIP: "::1", HostPort: 8080, Protocol: "tcp"}}},
+		{value: "[::]:443:443/tcp", want: []domain.PublishedPort{{HostIP: "::", HostPort: 443, Protocol: "tcp"}}},
+		{value: "[::1]::80"},
+		{value: "[::1:8080:80", wantErr: true},
+		{value: "[::1]:8080", wantErr: true},
+		{value: "1:2:3:4", wantErr: true},
+		{value: "x:80", wantErr: true},
+	}
+	for _, test := range tests {
+		ports, err := parseHostPorts(test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseHostPorts(%s) error = %v, want error %v", test.value, err, test.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(ports, test.want) {
+			t.Errorf("parseHostPorts(%s) = %+v, want %+v", test.value, ports, test.want)
+		}
+	}
+}
+
+func TestParseRunNeedsAttachedValues(t *testing.T) {
+	needs, err := parseRunNeeds("-d -p8080:80 -p=9090:90 -vdata:/data -v/srv:/srv --volume=cache:/cache --network=backend")
+	if err != nil {
+		t.Fatalf("parseRunNeeds: %v", err)
+	}
+
+	wantPorts := []domain.PublishedPort{{HostPort: 8080, Protocol: "tcp"}, {HostPort: 9090, Protocol: "tcp"}}
+	if !reflect.DeepEqual(needs.ports, wantPorts) {
+		t.Errorf("ports = %+v, want %+v", needs.ports, wantPorts)
+	}
+	if want := []string{"data", "cache"}; !reflect.DeepEqual(needs.volumes, want) {
+		t.Errorf("volumes = %v, want %v", needs.volumes, want)
+	}
+	if want := []string{"backend"}; !reflect.DeepEqual(needs.networks, want) {
+		t.Errorf("networks = %v, want %v", needs.networks, want)
+	}
+}
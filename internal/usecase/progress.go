@@ -0,0 +1,93 @@
+package usecase
+
+import (
+	"fmt"
+	"time"
+
+	"deployer/internal/domain"
+)
+
+// SetProgress sets the observer told when the steps of a deployment start
+// and end, and about the messages the deployment logs. Without one, progress
+// is not reported.
+func (d *DeploymentService) SetProgress(observer domain.ProgressObserver) {
+	d.progress = observer
+}
+
+func (d *DeploymentService) publish(event domain.ProgressEvent) {
+	if d.progress == nil {
+		return
+	}
+	if d.run != nil {
+		event.RunID = d.run.id()
+	}
+	event.Time = time.Now()
+	d.progress.Observe(event)
+}
+
+// publishStep reports a step event for the step at index i of a pipeline of
+// total steps. A step counts as done once it finished.
+func (d *DeploymentService) publishStep(eventType, service, name string, i, total int, duration time.Duration, err error) {
+	done := i
+	if eventType == domain.ProgressStepFinished {
+		done++
+	}
+	event := domain.ProgressEvent{
+		Type:     eventType,
+		Service:  service,
+		Step:     name,
+		Index:    i + 1,
+		Total:    total,
+		Percent:  done * 100 / total,
+		Duration: duration,
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	d.publish(event)
+}
+
+// progressLogger is the logger of the deployment service: it also publishes
+// the messages it writes, except debug ones, as log events. The services the
+// deployment service uses keep the logger they were created with, so their
+// own messages are not published.
+type progressLogger struct {
+	domain.FieldLogger
+	service *DeploymentService
+}
+
+func (l *progressLogger) With(fields map[string]string) domain.FieldLogger {
+	return l.with(fields)
+}
+
+// with is With keeping the logger's type, for the deployment service's own
+// scoped copies.
+func (l *progressLogger) with(fields map[string]string) *progressLogger {
+	return &progressLogger{FieldLogger: l.FieldLogger.With(fields), service: l.service}
+}
+
+func (l *progressLogger) Info(msg string, args ...interface{}) {
+	l.FieldLogger.Info(msg, args...)
+	l.publish("info", msg, args)
+}
+
+func (l *progressLogger) Error(msg string, args ...interface{}) {
+	l.FieldLogger.Error(msg, args...)
+	l.publish("error", msg, args)
+}
+
+func (l *progressLogger) Warning(msg string, args ...interface{}) {
+	l.FieldLogger.Warning(msg, args...)
+	l.publish("warning", msg, args)
+}
+
+func (l *progressLogger) Success(msg string, args ...interface{}) {
+	l.FieldLogger.Success(msg, args...)
+	l.publish("success", msg, args)
+}
+
+func (l *progressLogger) publish(level, msg string, args []interface{}) {
+	if l.service.progress != nil {
+		l.service.publish(domain.ProgressEvent{Type: domain.ProgressLog, Level: level, Message: fmt.Sprintf(msg, args...)})
+	}
+}
@@ -0,0 +1,94 @@
+package usecase_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"deployer/internal/domain"
+	"deployer/internal/usecase"
+)
+
+// recordingObserver keeps the progress events of deployments.
+type recordingObserver struct {
+	mu     sync.Mutex
+	events []domain.ProgressEvent
+}
+
+func (o *recordingObserver) Observe(event domain.ProgressEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, event)
+}
+
+// blockingShell runs no command until every deployment has reached its
+// shell step.
+type blockingShell struct {
+	ready sync.WaitGroup
+}
+
+func (s *blockingShell) RunLocal(command string, env map[string]string) error {
+	s.ready.Done()
+	s.ready.Wait()
+	return nil
+}
+
+func TestConcurrentDeploymentsPublishTheirOwnRunID(t *testing.T) {
+	shell := &blockingShell{}
+	shell.ready.Add(2)
+	observer := &recordingObserver{}
+	service := usecase.NewDeploymentService(nil, nil, nil, nil, shell, nil, nil, nil, &recordingLogger{})
+	service.SetProgress(observer)
+
+	config := &domain.Config{
+		Lock:     domain.LockConfig{Disabled: true},
+		Services: map[string]domain.DeployConfig{},
+	}
+	for _, name := range []string{"api", "web"} {
+		config.Services[name] = domain.DeployConfig{
+			ServiceName:   name,
+			ImageName:     name,
+			ContainerName: name,
+			Pipeline:      []domain.PipelineStep{{Type: "shell", Name: "Migrate " + name, Command: "./migrate.sh"}},
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"api", "web"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			request := domain.DeploymentRequest{ServiceName: name, Version: "1.0.0", Operator: "alice"}
+			if err := service.Deploy(request, config); err != nil {
+				t.Errorf("Deploy(%s) = %v, want nil", name, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Step events name their service, the log events of a step its name.
+	runIDs := make(map[string]string)
+	for _, event := range observer.events {
+		if event.Type == domain.ProgressLog {
+			for _, name := range []string{"api", "web"} {
+				if strings.HasSuffix(event.Message, "COMPLETED: Migrate "+name) {
+					event.Service = name
+				}
+			}
+		}
+		if event.Service == "" {
+			continue
+		}
+		if event.RunID == "" {
+			t.Errorf("%s event of %s has no run ID", event.Type, event.Service)
+			continue
+		}
+		if runID, seen := runIDs[event.Service]; seen && runID != event.RunID {
+			t.Errorf("%s events carry run IDs %s and %s", event.Service, runID, event.RunID)
+		}
+		runIDs[event.Service] = event.RunID
+	}
+	if len(runIDs) != 2 || runIDs["api"] == runIDs["web"] {
+		t.Errorf("run IDs = %v, want a distinct one for each deployment", runIDs)
+	}
+}
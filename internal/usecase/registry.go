@@ -0,0 +1,74 @@
+package usecase
+
+import (
+	"fmt"
+
+	"deployer/internal/domain"
+)
+
+// checkTagAvailable refuses to push a version that already exists in the
+// registry, since overwriting a tag changes what earlier deployments of it
+// refer to. It only applies when the steps about to run push the image, and
+// is bypassed by -force.
+func (d *DeploymentService) checkTagAvailable(serviceConfig domain.DeployConfig, request domain.DeploymentRequest, steps []step) error {
+	pushes := hasStep(steps, stepPush) || (len(serviceConfig.Platforms) > 0 && hasStep(steps, stepBuild))
+	if d.registry == nil || !pushes {
+		return nil
+	}
+
+	image := fmt.Sprintf("%s:%s", serviceConfig.ImageName, request.Version)
+	exists, err := d.registry.TagExists(serviceConfig.ImageName, request.Version)
+	if err != nil {
+		if request.DryRun {
+			d.logger.Warning("Unable to check whether %s exists in the registry: %v", image, err)
+			return nil
+		}
+		return fmt.Errorf("unable to check whether %s exists in the registry: %w", image, err)
+	}
+	if !exists {
+		return nil
+	}
+
+	if request.Force {
+		d.logger.Warning("%s already exists in the registry and will be overwritten", image)
+		return nil
+	}
+	return fmt.Errorf("%s already exists in the registry, use -force to overwrite it or pick a new version", image)
+}
+
+// checkResumedDigest makes sure that, when a resumed run deploys the image
+// pushed by the run it resumes instead of pushing again, the tag still
+// points to the recorded digest. Otherwise the run would deploy the old
+// image under a tag that now names another one. It is bypassed by -force.
+func (d *DeploymentService) checkResumedDigest(serviceConfig domain.DeployConfig, request domain.DeploymentRequest, steps []step, run *runTracker) error {
+	pushes := hasStep(steps, stepPush) || (len(serviceConfig.Platforms) > 0 && hasStep(steps, stepBuild))
+	recorded := run.previousService(serviceConfig.ServiceName).Digest
+	if d.registry == nil || request.DryRun || pushes || recorded == "" || serviceConfig.Transfer == transferSSH {
+		return nil
+	}
+
+	image := fmt.Sprintf("%s:%s", serviceConfig.ImageName, request.Version)
+	current, err := d.registry.ResolveDigest(serviceConfig.ImageName, request.Version)
+	if err != nil {
+		return fmt.Errorf("unable to check that %s is still %s: %w", image, recorded, err)
+	}
+	if current == recorded {
+		return nil
+	}
+
+	if request.Force {
+		d.logger.Warning("%s was pushed again since run %s, deploying the recorded %s rather than %s", image, run.previous.ID, recorded, current)
+		return nil
+	}
+	return fmt.Errorf("%s was pushed again since run %s and is now %s, not the recorded %s; use -force to deploy the recorded image anyway or start a new deployment",
+		image, run.previous.ID, current, recorded)
+}
+
+func hasStep(steps []step, kind string) bool {
+	for _, s := range steps {
+		if s.kind == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package usecase
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"deployer/internal/domain"
+)
+
+// PruneRegistry deletes the tags of a service's image from the registry that
+// the policy does not keep: tags beyond the Keep most recently created ones
+// and older than OlderThan. The image the service's container runs on the
+// target server, the version last deployed to each environment and host and
+// any version deployed within the Grace window, according to the run
+// history, are protected, along with every tag sharing their manifest.
+// Without any deployment of the service in the run history nothing is
+// deleted unless the policy forces it. With dryRun the tags are only listed.
+// When a remote Docker service is set, the SSH connection must already be
+// established.
+func (d *DeploymentService) PruneRegistry(serviceName string, policy domain.RegistryPrunePolicy, config *domain.Config, dryRun bool) (*domain.RegistryPrune, error) {
+	serviceConfig, exists := config.Services[serviceName]
+	if !exists {
+		return nil, fmt.Errorf("service '%s' not found in config", serviceName)
+	}
+	if d.registry == nil {
+		return nil, fmt.Errorf("no registry configured")
+	}
+
+	repository := serviceConfig.ImageName
+	prune := &domain.RegistryPrune{
+		Service:    serviceName,
+		Repository: fmt.Sprintf("%s/%s", config.Registry.Host, repository),
+	}
+
+	names, err := d.registry.ListTags(repository)
+	if err != nil {
+		return nil, err
+	}
+	var tags []domain.RegistryTag
+	for _, name := range names {
+		tag, err := d.registry.InspectTag(repository, name)
+		if err != nil {
+			return nil, fmt.Errorf("unable to inspect %s:%s: %w", repository, name, err)
+		}
+		tags = append(tags, *tag)
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].Created.After(tags[j].Created)
+	})
+
+	protectedTags, protectedDigests, err := d.recentlyDeployed(serviceName, time.Now().Add(-policy.Grace))
+	if err != nil {
+		return nil, err
+	}
+	if len(protectedTags) == 0 && !policy.Force {
+		if !dryRun {
+			return nil, fmt.Errorf("no deployment of '%s' in the run history of %s, refusing to delete tags that may be in use (use -force to delete anyway)", serviceName, config.StateDir)
+		}
+		d.logger.Warning("No deployment of '%s' in the run history, a real prune would refuse to delete tags without -force", serviceName)
+	}
+
+	if d.remoteDocker != nil {
+		state, err := d.remoteDocker.InspectContainer(serviceConfig.ContainerName)
+		if err != nil {
+			return nil, fmt.Errorf("unable to check the image running on %s: %w", config.SSH.Host, err)
+		}
+		if state != nil {
+			tag, digest := splitReference(state.Image)
+			if tag != "" {
+				protectedTags[tag] = true
+			}
+			if digest != "" {
+				protectedDigests[digest] = true
+			}
+		}
+	}
+
+	// Deleting a manifest deletes every tag pointing to it, so a manifest is
+	// only deleted when none of its tags is kept. Tags whose age is unknown
+	// are kept.
+	kept := make(map[string]bool)
+	var candidates []domain.RegistryTag
+	cutoff := time.Now().Add(-policy.OlderThan)
+	for i, tag := range tags {
+		switch {
+		case i < policy.Keep, tag.Created.After(cutoff), tag.Created.IsZero(), tag.Digest == "":
+			kept[tag.Digest] = true
+		case protectedTags[tag.Tag] || protectedDigests[tag.Digest]:
+			kept[tag.Digest] = true
+			prune.Protected = append(prune.Protected, tag)
+		default:
+			candidates = append(candidates, tag)
+		}
+	}
+
+	deleted := make(map[string]error)
+	for _, tag := range candidates {
+		if kept[tag.Digest] {
+			continue
+		}
+		err, done := deleted[tag.Digest]
+		if !done {
+			if !dryRun {
+				err = d.registry.DeleteManifest(repository, tag.Digest)
+				if err != nil {
+					d.logger.Warning("Unable to delete %s:%s: %v", repository, tag.Tag, err)
+				}
+			}
+			deleted[tag.Digest] = err
+		}
+		if err == nil {
+			prune.Deleted = append(prune.Deleted, tag)
+		}
+	}
+	return prune, nil
+}
+
+// recentlyDeployed returns the versions and digests of a service that are
+// currently deployed, by the newest run to each environment and host that
+// deployed it, or were deployed since the given time. Runs that failed count
+// for the services they got as far as running.
+func (d *DeploymentService) recentlyDeployed(service string, since time.Time) (map[string]bool, map[string]bool, error) {
+	deployments, err := d.deployments(service)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tags := make(map[string]bool)
+	digests := make(map[string]bool)
+	for _, deployment := range deployments {
+		if deployment.current || deployment.run.StartedAt.After(since) {
+			tags[deployment.run.Version] = true
+			if deployment.service.Digest != "" {
+				digests[deployment.service.Digest] = true
+			}
+		}
+	}
+	return tags, digests, nil
+}
+
+// splitReference returns the tag or the digest an image reference such as
+// registry:5000/app:1.2.0 or registry:5000/app@sha256:... points to.
+func splitReference(reference string) (tag, digest string) {
+	if i := strings.Index(reference, "@"); i >= 0 {
+		return "", reference[i+1:]
+	}
+	if i := strings.LastIndex(reference, ":"); i > strings.LastIndex(reference, "/") {
+		return reference[i+1:], ""
+	}
+	return "", ""
+}
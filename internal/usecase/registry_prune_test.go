@@ -0,0 +1,74 @@
+package usecase
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"deployer/internal/domain"
+)
+
+func TestRecentlyDeployedCountsPartiallyFailedRuns(t *testing.T) {
+	started := time.Now().Add(-48 * time.Hour)
+	store := historyStore{runs: []*domain.DeploymentRun{
+		{
+			ID:        "failed",
+			Version:   "1.3.0",
+			Status:    domain.RunFailed,
+			StartedAt: started.Add(time.Hour),
+			Services: []domain.ServiceRun{
+				{Name: "api", Digest: "sha256:api-130", Steps: []domain.StepRun{
+					{Kind: stepPush, Status: domain.StepSucceeded},
+					{Kind: stepRun, Status: domain.StepSucceeded},
+					{Kind: stepVerify, Status: domain.StepSucceeded},
+				}},
+				{Name: "web", Digest: "sha256:web-130", Steps: []domain.StepRun{
+					{Kind: stepPush, Status: domain.StepSucceeded},
+					{Kind: stepRun, Status: domain.StepFailed},
+				}},
+			},
+		},
+		{
+			ID:        "succeeded",
+			Version:   "1.2.0",
+			Status:    domain.RunSucceeded,
+			StartedAt: started,
+			Services: []domain.ServiceRun{
+				{Name: "api", Digest: "sha256:api-120"},
+				{Name: "web", Digest: "sha256:web-120"},
+			},
+		},
+	}}
+	service := NewDeploymentService(nil, nil, nil, nil, nil, nil, store, nil, nil)
+
+	tests := []struct {
+		service     string
+		wantTags    string
+		wantDigests string
+	}{
+		{service: "api", wantTags: "1.3.0", wantDigests: "sha256:api-130"},
+		{service: "web", wantTags: "1.2.0", wantDigests: "sha256:web-120"},
+	}
+	for _, test := range tests {
+		tags, digests, err := service.recentlyDeployed(test.service, time.Now())
+		if err != nil {
+			t.Fatalf("recentlyDeployed(%s): %v", test.service, err)
+		}
+		if got := joinKeys(tags); got != test.wantTags {
+			t.Errorf("recentlyDeployed(%s) tags = %s, want %s", test.service, got, test.wantTags)
+		}
+		if got := joinKeys(digests); got != test.wantDigests {
+			t.Errorf("recentlyDeployed(%s) digests = %s, want %s", test.service, got, test.wantDigests)
+		}
+	}
+}
+
+func joinKeys(set map[string]bool) string {
+	var keys []string
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, " ")
+}
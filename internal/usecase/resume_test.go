@@ -0,0 +1,114 @@
+package usecase_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"deployer/internal/domain"
+	"deployer/internal/usecase"
+)
+
+// memoryRunStore keeps runs in memory.
+type memoryRunStore struct {
+	runs map[string]*domain.DeploymentRun
+}
+
+func (s *memoryRunStore) Save(run *domain.DeploymentRun) error {
+	copied := *run
+	s.runs[run.ID] = &copied
+	return nil
+}
+
+func (s *memoryRunStore) Load(id string) (*domain.DeploymentRun, error) {
+	run, ok := s.runs[id]
+	if !ok {
+		return nil, fmt.Errorf("run %s not found", id)
+	}
+	return run, nil
+}
+
+func (s *memoryRunStore) List() ([]*domain.DeploymentRun, error) {
+	var runs []*domain.DeploymentRun
+	for _, run := range s.runs {
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// digestRegistry resolves every tag to the same digest.
+type digestRegistry struct {
+	domain.RegistryService
+	digest string
+}
+
+func (r *digestRegistry) ResolveDigest(repository, tag string) (string, error) {
+	return r.digest, nil
+}
+
+func TestResumeChecksRecordedDigest(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		force   bool
+		wantErr string
+	}{
+		{name: "unchanged", current: "sha256:recorded"},
+		{name: "pushed again", current: "sha256:other", wantErr: "was pushed again since run failed-run"},
+		{name: "pushed again with force", current: "sha256:other", force: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := &memoryRunStore{runs: map[string]*domain.DeploymentRun{
+				"failed-run": {
+					ID:      "failed-run",
+					Version: "1.0.0",
+					Status:  domain.RunFailed,
+					Services: []domain.ServiceRun{{
+						Name:   "api",
+						Image:  "registry.example.com/api:1.0.0",
+						Digest: "sha256:recorded",
+						Steps:  []domain.StepRun{{Kind: "shell", Status: domain.StepFailed}},
+					}},
+				},
+			}}
+			logger := &recordingLogger{}
+			shell := &localShell{}
+			registry := &digestRegistry{digest: test.current}
+			service := usecase.NewDeploymentService(nil, nil, registry, nil, shell, nil, store, nil, logger)
+
+			config := &domain.Config{
+				Lock: domain.LockConfig{Disabled: true},
+				Services: map[string]domain.DeployConfig{
+					"api": {
+						ServiceName:   "api",
+						ImageName:     "api",
+						ContainerName: "api",
+						Pipeline:      []domain.PipelineStep{{Type: "shell", Command: "./migrate.sh"}},
+					},
+				},
+			}
+			request := domain.DeploymentRequest{ResumeRunID: "failed-run", Force: test.force, Operator: "alice"}
+			err := service.Deploy(request, config)
+
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("Deploy = %v, want an error containing %q", err, test.wantErr)
+				}
+				if len(shell.commands) != 0 {
+					t.Errorf("commands run = %v, want none", shell.commands)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Deploy = %v, want nil", err)
+			}
+			if len(shell.commands) != 1 {
+				t.Errorf("commands run = %v, want the pipeline's shell step", shell.commands)
+			}
+			if test.force && len(logger.warnings) == 0 {
+				t.Error("no warning logged about the tag pushed again")
+			}
+		})
+	}
+}
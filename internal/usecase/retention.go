@@ -0,0 +1,124 @@
+package usecase
+
+import (
+	"fmt"
+	"sort"
+
+	"deployer/internal/domain"
+	"deployer/pkg/bytesize"
+)
+
+// PruneImages removes from the target server the images of a service that
+// the retention policy does not keep: the keep most recently created tags,
+// the image of the service's container, the current version and the
+// previous one a rollback returns to. An empty current version means the
+// last successfully deployed one. Without a known previous version, the
+// newest image other than the current one is kept for a rollback instead.
+// With dryRun the images are only listed.
+// The SSH connection must already be established.
+func (d *DeploymentService) PruneImages(serviceName string, keep int, current string, config *domain.Config, dryRun bool) (*domain.ImagePrune, error) {
+	serviceConfig, exists := config.Services[serviceName]
+	if !exists {
+		return nil, fmt.Errorf("service '%s' not found in config", serviceName)
+	}
+
+	prune := &domain.ImagePrune{
+		Service:    serviceName,
+		Repository: deployedRepository(serviceConfig, config.Registry),
+		Keep:       keep,
+	}
+	images, err := d.remoteDocker.ListImages(prune.Repository)
+	if err != nil {
+		return nil, err
+	}
+
+	protectedIDs := make(map[string]bool)
+	state, err := d.remoteDocker.InspectContainer(serviceConfig.ContainerName)
+	if err != nil {
+		return nil, err
+	}
+	if state != nil && state.ImageID != "" {
+		protectedIDs[state.ImageID] = true
+	}
+
+	protected := make(map[string]bool)
+	if current == "" {
+		if history := d.deployedVersions(serviceName, config); len(history) > 0 {
+			current = history[0]
+		}
+	}
+	var previous string
+	if current != "" {
+		protected[current] = true
+		previous = d.previousVersion(serviceName, current, config)
+	}
+
+	sort.SliceStable(images, func(i, j int) bool {
+		return images[i].Created.After(images[j].Created)
+	})
+
+	if previous == "" {
+		for _, image := range images {
+			if image.Tag != current && !protectedIDs[image.ID] {
+				previous = image.Tag
+				break
+			}
+		}
+	}
+	if previous != "" {
+		protected[previous] = true
+	}
+
+	// Tags left on each image; an image is only deleted, and its space
+	// reclaimed, once its last tag is removed.
+	remaining := make(map[string]int)
+	var candidates []domain.RemoteImage
+	for i, image := range images {
+		if i < keep || protected[image.Tag] || protectedIDs[image.ID] {
+			remaining[image.ID]++
+			continue
+		}
+		candidates = append(candidates, image)
+	}
+
+	for _, image := range candidates {
+		if !dryRun {
+			if err := d.remoteDocker.RemoveImage(image.Reference); err != nil {
+				d.logger.Warning("%v", err)
+				remaining[image.ID]++
+				continue
+			}
+		}
+		prune.Removed = append(prune.Removed, image)
+	}
+
+	counted := make(map[string]bool)
+	for _, image := range prune.Removed {
+		if remaining[image.ID] == 0 && !counted[image.ID] {
+			counted[image.ID] = true
+			prune.Reclaimed += image.Size
+		}
+	}
+	return prune, nil
+}
+
+// retainImages applies the retain_images policy of a service once its new
+// version is deployed. Failing to clean up does not fail the deployment.
+func (d *DeploymentService) retainImages(serviceConfig domain.DeployConfig, request domain.DeploymentRequest, config *domain.Config, steps []step) {
+	if serviceConfig.RetainImages <= 0 || request.DryRun {
+		return
+	}
+	// Only pipelines that bring an image to the server add to its images.
+	if !hasStep(steps, stepPull) && !hasStep(steps, stepTransfer) {
+		return
+	}
+
+	prune, err := d.PruneImages(serviceConfig.ServiceName, serviceConfig.RetainImages, request.Version, config, false)
+	if err != nil {
+		d.logger.Warning("Unable to remove old images of %s: %v", serviceConfig.ServiceName, err)
+		return
+	}
+	if len(prune.Removed) > 0 {
+		d.logger.Info("Removed %d old image(s) of %s, reclaimed %s", len(prune.Removed), serviceConfig.ServiceName, bytesize.Format(prune.Reclaimed))
+	}
+}
@@ -0,0 +1,291 @@
+package usecase
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"deployer/internal/domain"
+)
+
+// Kinds of the steps inserted by withSession. They are always rerun when a
+// deployment is resumed.
+const (
+	stepLogin   = "login"
+	stepConnect = "connect"
+)
+
+// runTracker records the progress of a deployment run in the run store, so a
+// failed run can be resumed, and decides which steps a resumed run skips.
+type runTracker struct {
+	mu       sync.Mutex
+	store    domain.RunStore
+	run      *domain.DeploymentRun
+	previous *domain.DeploymentRun
+	fromStep string
+	skip     map[string]bool
+	persist  bool
+	logger   domain.Logger
+	// locks are the deployment locks held while the run's steps run.
+	locks *heldLocks
+}
+
+// startRun creates the tracker for a deployment. When resuming, the services,
+// version and build path of the previous run fill in whatever the request
+// leaves empty.
+func (d *DeploymentService) startRun(request *domain.DeploymentRequest, config *domain.Config) (*runTracker, error) {
+	t := &runTracker{
+		store:    d.runStore,
+		fromStep: request.FromStep,
+		skip:     make(map[string]bool, len(request.SkipSteps)),
+		persist:  d.runStore != nil && !request.DryRun,
+		logger:   d.logger,
+	}
+	for _, kind := range request.SkipSteps {
+		t.skip[kind] = true
+	}
+
+	if request.ResumeRunID != "" {
+		if d.runStore == nil {
+			return nil, fmt.Errorf("cannot resume run %s: no run store configured", request.ResumeRunID)
+		}
+		previous, err := d.runStore.Load(request.ResumeRunID)
+		if err != nil {
+			return nil, err
+		}
+		if previous.Status == domain.RunSucceeded {
+			return nil, fmt.Errorf("run %s already succeeded, nothing to resume", previous.ID)
+		}
+		t.previous = previous
+
+		if len(request.ServiceNames) == 0 && request.ServiceName == "" {
+			for _, service := range previous.Services {
+				request.ServiceNames = append(request.ServiceNames, service.Name)
+			}
+		}
+		if request.Version == "" {
+			request.Version = previous.Version
+		} else if request.Version != previous.Version {
+			return nil, fmt.Errorf("run %s deployed version %s, not %s", previous.ID, previous.Version, request.Version)
+		}
+		if request.BuildPathOverride == "" {
+			request.BuildPathOverride = previous.BuildPath
+		}
+	}
+
+	if len(request.ServiceNames) == 0 {
+		request.ServiceNames = []string{request.ServiceName}
+	}
+
+	t.run = &domain.DeploymentRun{
+		ID:          newRunID(),
+		Version:     request.Version,
+		Environment: config.Environment,
+		Host:        config.SSH.Host,
+		BuildPath:   request.BuildPathOverride,
+		Status:      domain.RunRunning,
+		StartedAt:   time.Now().UTC(),
+	}
+	for _, name := range request.ServiceNames {
+		// A resumed run carries over the image pushed before, so that a run
+		// resuming it in turn still pulls and protects the same digest.
+		previous := t.previousService(name)
+		t.run.Services = append(t.run.Services, domain.ServiceRun{Name: name, Image: previous.Image, Digest: previous.Digest})
+	}
+
+	if t.previous != nil {
+		d.logger.Info("Run ID: %s (resuming %s)", t.run.ID, t.previous.ID)
+	} else {
+		d.logger.Info("Run ID: %s", t.run.ID)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.save()
+	return t, nil
+}
+
+func newRunID() string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// filter drops the steps of a service that should not run: steps listed in
+// --skip, steps before --from-step, and, when resuming, the steps that
+// already completed in the previous run.
+func (t *runTracker) filter(service string, steps []step) ([]step, error) {
+	done := make(map[string]bool)
+	if t.previous != nil && t.fromStep == "" {
+		seen := make(map[string]int)
+		for _, previous := range t.previousService(service).Steps {
+			key := stepKey(previous.Kind, seen)
+			if previous.Status != domain.StepSucceeded && previous.Status != domain.StepSkipped {
+				break
+			}
+			done[key] = true
+		}
+	}
+
+	started := t.fromStep == ""
+	seen := make(map[string]int)
+	var kept []step
+	for _, s := range steps {
+		key := stepKey(s.kind, seen)
+		if !started && s.kind == t.fromStep {
+			started = true
+		}
+
+		var reason string
+		switch {
+		case !started:
+			reason = fmt.Sprintf("before --from-step %s", t.fromStep)
+		case t.skip[s.kind]:
+			reason = "--skip"
+		case done[key]:
+			reason = "completed in run " + t.previous.ID
+		default:
+			kept = append(kept, s)
+			continue
+		}
+
+		t.logger.Info("Skipping '%s' (%s)", s.name, reason)
+		t.record(service, s, domain.StepSkipped, nil, time.Now())
+	}
+
+	if !started {
+		return nil, fmt.Errorf("service '%s' has no '%s' step to start from", service, t.fromStep)
+	}
+
+	return kept, nil
+}
+
+// stepKey identifies a step of a pipeline by its kind and how many steps of
+// that kind come before it, so that renaming a step or adding hooks does not
+// change which steps a resumed run considers completed.
+func stepKey(kind string, seen map[string]int) string {
+	key := fmt.Sprintf("%s#%d", kind, seen[kind])
+	seen[kind]++
+	return key
+}
+
+// track wraps the steps of a service so that their outcome is recorded.
+func (t *runTracker) track(service string, steps []step) []step {
+	tracked := make([]step, len(steps))
+	for i, s := range steps {
+		fn := s.fn
+		s.fn = func() error {
+			started := time.Now()
+			err := fn()
+			if err != nil {
+				t.record(service, s, domain.StepFailed, err, started)
+			} else {
+				t.record(service, s, domain.StepSucceeded, nil, started)
+			}
+			return err
+		}
+		tracked[i] = s
+	}
+	return tracked
+}
+
+func (t *runTracker) record(service string, s step, status string, err error, started time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := domain.StepRun{
+		Kind:       s.kind,
+		Name:       s.name,
+		Status:     status,
+		StartedAt:  started.UTC(),
+		FinishedAt: time.Now().UTC(),
+	}
+	if err != nil {
+		state.Error = err.Error()
+	}
+
+	serviceRun := t.service(service)
+	serviceRun.Steps = append(serviceRun.Steps, state)
+	t.save()
+}
+
+// setImage records the image pushed for a service and its registry digest.
+func (t *runTracker) setImage(service, image, digest string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	serviceRun := t.service(service)
+	serviceRun.Image = image
+	serviceRun.Digest = digest
+	t.save()
+}
+
+// digest returns the registry digest of the image pushed for a service in
+// this run or in the run it resumes, which carries it over from its own.
+func (t *runTracker) digest(service string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.service(service).Digest
+}
+
+func (t *runTracker) id() string {
+	return t.run.ID
+}
+
+func (t *runTracker) resuming() bool {
+	return t.previous != nil
+}
+
+// finish marks the run as done and, on failure, tells how to resume it.
+func (t *runTracker) finish(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.run.FinishedAt = time.Now().UTC()
+	if err != nil {
+		t.run.Status = domain.RunFailed
+		t.run.Error = err.Error()
+	} else {
+		t.run.Status = domain.RunSucceeded
+	}
+	t.save()
+
+	if err != nil && t.persist {
+		t.logger.Info("Resume this deployment with: deployer deploy --resume %s", t.run.ID)
+	}
+}
+
+func (t *runTracker) service(name string) *domain.ServiceRun {
+	for i := range t.run.Services {
+		if t.run.Services[i].Name == name {
+			return &t.run.Services[i]
+		}
+	}
+	t.run.Services = append(t.run.Services, domain.ServiceRun{Name: name})
+	return &t.run.Services[len(t.run.Services)-1]
+}
+
+func (t *runTracker) previousService(name string) domain.ServiceRun {
+	if t.previous != nil {
+		for _, service := range t.previous.Services {
+			if service.Name == name {
+				return service
+			}
+		}
+	}
+	return domain.ServiceRun{Name: name}
+}
+
+// save persists the run. Callers must hold t.mu. A failure to save is only a
+// warning: losing the ability to resume must not fail a deployment.
+func (t *runTracker) save() {
+	if !t.persist {
+		return
+	}
+	if err := t.store.Save(t.run); err != nil {
+		t.logger.Warning("Unable to save run state: %v", err)
+	}
+}
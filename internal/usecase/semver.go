@@ -0,0 +1,152 @@
+package usecase
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Versioning policies a service can declare with "versioning".
+const (
+	versioningFree   = "free"
+	versioningSemver = "semver"
+	versioningCalver = "calver"
+)
+
+var (
+	semverPattern = regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?$`)
+	calverPattern = regexp.MustCompile(`^(\d{4})\.(\d{1,2})(?:\.(\d+))?(?:-([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?$`)
+
+	// describePattern matches the suffix git describe adds to a tag: the
+	// number of commits since the tag and the abbreviated commit SHA.
+	describePattern = regexp.MustCompile(`^(?:(.*)-)?(\d+)-g[0-9a-f]{4,40}(?:-dirty)?$`)
+)
+
+// parsedVersion is a semver (major, minor, patch) or calver (year, month,
+// micro) version with an optional pre-release suffix such as "rc.1" or
+// "dirty". A version derived by git describe, such as 1.4.0-3-gabc1234,
+// has the number of commits since its tag as distance.
+type parsedVersion struct {
+	numbers    [3]int
+	prerelease string
+	distance   int
+}
+
+func parseVersion(policy, version string) (parsedVersion, error) {
+	var parsed parsedVersion
+	pattern := semverPattern
+	if policy == versioningCalver {
+		pattern = calverPattern
+	}
+
+	match := pattern.FindStringSubmatch(version)
+	if match == nil {
+		example := "1.4.2"
+		if policy == versioningCalver {
+			example = "2026.10.0"
+		}
+		return parsed, fmt.Errorf("'%s' is not a valid %s version (e.g. %s)", version, policy, example)
+	}
+
+	for i := 0; i < 3; i++ {
+		parsed.numbers[i], _ = strconv.Atoi(match[i+1])
+	}
+	parsed.prerelease = match[4]
+	// 1.4.0-3-gabc1234 is three commits after 1.4.0, not a pre-release of
+	// it.
+	if describe := describePattern.FindStringSubmatch(parsed.prerelease); describe != nil {
+		parsed.prerelease = describe[1]
+		parsed.distance, _ = strconv.Atoi(describe[2])
+	}
+
+	if policy == versioningCalver && (parsed.numbers[1] < 1 || parsed.numbers[1] > 12) {
+		return parsed, fmt.Errorf("'%s' is not a valid calver version: month %d", version, parsed.numbers[1])
+	}
+	return parsed, nil
+}
+
+// compare orders versions like semver: numbers first, then a version
+// without pre-release above one with it, then the pre-release identifiers,
+// then the distance from the tag, so that 1.4.0 < 1.4.0-3-gabc1234 < 1.4.1.
+func (v parsedVersion) compare(other parsedVersion) int {
+	for i := range v.numbers {
+		if v.numbers[i] != other.numbers[i] {
+			return compareInts(v.numbers[i], other.numbers[i])
+		}
+	}
+
+	switch {
+	case v.prerelease == other.prerelease:
+		return compareInts(v.distance, other.distance)
+	case v.prerelease == "":
+		return 1
+	case other.prerelease == "":
+		return -1
+	}
+
+	a, b := strings.Split(v.prerelease, "."), strings.Split(other.prerelease, ".")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] == b[i] {
+			continue
+		}
+		na, errA := strconv.Atoi(a[i])
+		nb, errB := strconv.Atoi(b[i])
+		switch {
+		case errA == nil && errB == nil:
+			return compareInts(na, nb)
+		case errA == nil:
+			return -1
+		case errB == nil:
+			return 1
+		}
+		return strings.Compare(a[i], b[i])
+	}
+	return compareInts(len(a), len(b))
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// nextVersion returns the version following latest (nil when there is none).
+// Semver increments the given part; calver uses the current year and month
+// and increments the micro number within a month, whatever the part.
+func nextVersion(policy string, latest *parsedVersion, part string, now time.Time) (string, error) {
+	switch part {
+	case "major", "minor", "patch":
+	default:
+		return "", fmt.Errorf("unknown version bump '%s' (expected patch, minor or major)", part)
+	}
+
+	switch policy {
+	case versioningSemver:
+		var n [3]int
+		if latest != nil {
+			n = latest.numbers
+		}
+		switch part {
+		case "major":
+			n = [3]int{n[0] + 1, 0, 0}
+		case "minor":
+			n = [3]int{n[0], n[1] + 1, 0}
+		default:
+			n[2]++
+		}
+		return fmt.Sprintf("%d.%d.%d", n[0], n[1], n[2]), nil
+	case versioningCalver:
+		micro := 0
+		if latest != nil && latest.numbers[0] == now.Year() && latest.numbers[1] == int(now.Month()) {
+			micro = latest.numbers[2] + 1
+		}
+		return fmt.Sprintf("%d.%02d.%d", now.Year(), int(now.Month()), micro), nil
+	}
+	return "", fmt.Errorf("version bumps need \"versioning\": \"semver\" or \"calver\"")
+}
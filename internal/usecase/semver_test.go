@@ -0,0 +1,67 @@
+package usecase
+
+import (
+	"testing"
+
+	"deployer/internal/domain"
+)
+
+func TestCompareDescribeVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "1.4.0-3-gabc1234", b: "1.4.0", want: 1},
+		{a: "1.4.0-3-gabc1234", b: "1.4.0-12-gdef5678", want: -1},
+		{a: "1.4.0-3-gabc1234", b: "1.4.1", want: -1},
+		{a: "1.4.0-3-gabc1234-dirty", b: "1.4.0", want: 1},
+		{a: "1.4.0-rc.1-2-gabc1234", b: "1.4.0-rc.1", want: 1},
+		{a: "1.4.0-rc.1-2-gabc1234", b: "1.4.0", want: -1},
+		{a: "1.4.0-rc.1", b: "1.4.0", want: -1},
+	}
+	for _, test := range tests {
+		a, err := parseVersion(versioningSemver, test.a)
+		if err != nil {
+			t.Fatalf("parseVersion(%s): %v", test.a, err)
+		}
+		b, err := parseVersion(versioningSemver, test.b)
+		if err != nil {
+			t.Fatalf("parseVersion(%s): %v", test.b, err)
+		}
+		if got := a.compare(b); got != test.want {
+			t.Errorf("compare(%s, %s) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+// historyStore returns a fixed deployment history.
+type historyStore struct {
+	domain.RunStore
+	runs []*domain.DeploymentRun
+}
+
+func (s historyStore) List() ([]*domain.DeploymentRun, error) {
+	return s.runs, nil
+}
+
+func TestDescribeVersionIsNotADowngrade(t *testing.T) {
+	store := historyStore{runs: []*domain.DeploymentRun{{
+		ID:       "previous",
+		Version:  "1.4.0",
+		Status:   domain.RunSucceeded,
+		Services: []domain.ServiceRun{{Name: "api"}},
+	}}}
+	service := NewDeploymentService(nil, nil, nil, nil, nil, nil, store, nil, nil)
+	config := &domain.Config{Services: map[string]domain.DeployConfig{
+		"api": {ServiceName: "api", Versioning: versioningSemver, Downgrade: "block"},
+	}}
+
+	request := domain.DeploymentRequest{ServiceName: "api", Version: "1.4.0-3-gabc1234"}
+	if err := service.checkVersionPolicy(request, config); err != nil {
+		t.Errorf("checkVersionPolicy(%s) = %v, want nil", request.Version, err)
+	}
+	request.Version = "1.3.9"
+	if err := service.checkVersionPolicy(request, config); err == nil {
+		t.Errorf("checkVersionPolicy(%s) succeeded, want a blocked downgrade", request.Version)
+	}
+}
@@ -0,0 +1,134 @@
+package usecase
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"deployer/internal/domain"
+	"deployer/pkg/bytesize"
+)
+
+// transferSSH is the transfer mode that ships images over the SSH
+// connection instead of through the registry.
+const transferSSH = "ssh"
+
+// deployedImage returns the image reference the target server runs: the
+// registry image, or the local image name for services transferred over SSH.
+func deployedImage(serviceConfig domain.DeployConfig, version string, registry domain.RegistryConfig) string {
+	return fmt.Sprintf("%s:%s", deployedRepository(serviceConfig, registry), version)
+}
+
+// deployedRepository returns the repository of the images a service is run
+// from on the target server.
+func deployedRepository(serviceConfig domain.DeployConfig, registry domain.RegistryConfig) string {
+	if serviceConfig.Transfer == transferSSH {
+		return serviceConfig.ImageName
+	}
+	return fmt.Sprintf("%s/%s", registry.Host, serviceConfig.ImageName)
+}
+
+// transferImage streams the locally built image to the target server as a
+// gzip-compressed docker save archive and loads it there. When the server
+// already has an image with the same ID only the tag is added.
+func (d *DeploymentService) transferImage(serviceConfig domain.DeployConfig, version string, run *runTracker, dryRun bool) error {
+	image := fmt.Sprintf("%s:%s", serviceConfig.ImageName, version)
+
+	info, err := d.dockerService.InspectImage(image)
+	if err != nil {
+		return err
+	}
+	d.checkPlatform(serviceConfig, image)
+
+	if info.ID != "" {
+		exists, err := d.remoteDocker.HasImage(info.ID)
+		if err != nil {
+			return err
+		}
+		if exists {
+			d.logger.Info("Remote already has image %s (%s), skipping transfer", image, shortID(info.ID))
+			if err := d.remoteDocker.TagImage(info.ID, image); err != nil {
+				return err
+			}
+			run.setImage(serviceConfig.ServiceName, image, "")
+			return nil
+		}
+	}
+
+	if dryRun {
+		if err := d.dockerService.SaveImage(image, io.Discard); err != nil {
+			return err
+		}
+		return d.remoteDocker.LoadImage(strings.NewReader(""))
+	}
+
+	reader, writer := io.Pipe()
+	saved := make(chan error, 1)
+	go func() {
+		compressed := gzip.NewWriter(writer)
+		progress := &progressWriter{w: compressed, total: info.Size, logger: d.logger}
+		err := d.dockerService.SaveImage(image, progress)
+		if closeErr := compressed.Close(); err == nil {
+			err = closeErr
+		}
+		writer.CloseWithError(err)
+		saved <- err
+	}()
+
+	err = d.remoteDocker.LoadImage(reader)
+	reader.CloseWithError(io.ErrClosedPipe)
+	// A failed save also breaks the load, report its cause first.
+	if saveErr := <-saved; saveErr != nil && !errors.Is(saveErr, io.ErrClosedPipe) {
+		return saveErr
+	}
+	if err != nil {
+		return err
+	}
+
+	d.logger.Info("Image transferred: %s", image)
+	run.setImage(serviceConfig.ServiceName, image, "")
+	return nil
+}
+
+// progressWriter logs how much of an image archive has been written, every
+// 10% of its expected size or every 50 MB when the size is unknown.
+type progressWriter struct {
+	w       io.Writer
+	total   int64
+	written int64
+	logged  int64
+	logger  domain.Logger
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+
+	step := p.total / 10
+	if step <= 0 {
+		step = 50 << 20
+	}
+	if p.written-p.logged >= step {
+		p.logged = p.written
+		if p.total > 0 {
+			percent := p.written * 100 / p.total
+			if percent > 100 {
+				percent = 100
+			}
+			p.logger.Info("Transferred %d%% (%s of %s)", percent, bytesize.Format(p.written), bytesize.Format(p.total))
+		} else {
+			p.logger.Info("Transferred %s", bytesize.Format(p.written))
+		}
+	}
+	return n, err
+}
+
+func shortID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
@@ -0,0 +1,182 @@
+package usecase
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"deployer/internal/domain"
+)
+
+// productionEnvironment is the environment name that refuses deploying
+// uncommitted changes.
+const productionEnvironment = "production"
+
+// resolveVersion fills in a missing request version from git. All selected
+// services must agree on it, so services built from different repositories
+// need an explicit -version.
+func (d *DeploymentService) resolveVersion(request *domain.DeploymentRequest, config *domain.Config) error {
+	versions := make(map[string][]string)
+	var version string
+	for _, name := range requestedServices(*request) {
+		serviceConfig := config.Services[name]
+		if request.BuildPathOverride != "" {
+			serviceConfig.BuildPath = request.BuildPathOverride
+		}
+		if serviceConfig.BuildPath == "" {
+			continue
+		}
+
+		derived, err := d.sourceControl.Version(serviceConfig.BuildPath)
+		if err != nil {
+			return fmt.Errorf("unable to derive a version for %s from git: %w", name, err)
+		}
+		if derived == "" {
+			return fmt.Errorf("no -version given and the build path of %s is not a git repository", name)
+		}
+		versions[derived] = append(versions[derived], name)
+		version = derived
+	}
+
+	if len(versions) == 0 {
+		return fmt.Errorf("no -version given and no selected service has a build path to derive it from")
+	}
+	if len(versions) > 1 {
+		var parts []string
+		for v, names := range versions {
+			parts = append(parts, fmt.Sprintf("%s (%s)", v, strings.Join(names, ", ")))
+		}
+		return fmt.Errorf("selected services derive different versions from git: %s; pass -version", strings.Join(parts, ", "))
+	}
+
+	d.logger.Info("Version from git: %s", version)
+	request.Version = version
+	return nil
+}
+
+// checkSourceTree refuses to build uncommitted changes for the production
+// environment unless -allow-dirty is given, since the image could not be
+// rebuilt from any commit.
+func (d *DeploymentService) checkSourceTree(request domain.DeploymentRequest, config *domain.Config) error {
+	if config.Environment != productionEnvironment {
+		return nil
+	}
+
+	for _, name := range requestedServices(request) {
+		serviceConfig := config.Services[name]
+		if request.BuildPathOverride != "" {
+			serviceConfig.BuildPath = request.BuildPathOverride
+		}
+		if serviceConfig.BuildPath == "" {
+			continue
+		}
+
+		dirty, err := d.sourceControl.Dirty(serviceConfig.BuildPath)
+		if err != nil {
+			return fmt.Errorf("unable to check git status of %s: %w", name, err)
+		}
+		if !dirty {
+			continue
+		}
+		if request.AllowDirty {
+			d.logger.Warning("Deploying uncommitted changes of %s to production", name)
+			continue
+		}
+		return fmt.Errorf("%s has uncommitted changes in %s, commit them or use -allow-dirty to deploy to production anyway", name, serviceConfig.BuildPath)
+	}
+	return nil
+}
+
+func requestedServices(request domain.DeploymentRequest) []string {
+	if len(request.ServiceNames) > 0 {
+		return request.ServiceNames
+	}
+	if request.ServiceName != "" {
+		return []string{request.ServiceName}
+	}
+	return nil
+}
+
+// bumpVersion computes the request version by bumping the highest version
+// found in the registry tags and deployment history of the selected
+// services, which must share a semver or calver versioning policy.
+func (d *DeploymentService) bumpVersion(request *domain.DeploymentRequest, config *domain.Config) error {
+	names := requestedServices(*request)
+	policy := ""
+	for _, name := range names {
+		serviceVersioning := config.Services[name].Versioning
+		if serviceVersioning != versioningSemver && serviceVersioning != versioningCalver {
+			return fmt.Errorf("-bump needs \"versioning\": \"semver\" or \"calver\" for %s", name)
+		}
+		if policy != "" && serviceVersioning != policy {
+			return fmt.Errorf("-bump needs the selected services to share a versioning policy")
+		}
+		policy = serviceVersioning
+	}
+
+	var latest *parsedVersion
+	for _, name := range names {
+		candidates := d.deployedVersions(name, nil)
+		if running := d.runningVersion(config.Services[name], config, request.DryRun); running != "" {
+			candidates = append(candidates, running)
+		}
+		if d.registry != nil {
+			tags, err := d.registry.ListTags(config.Services[name].ImageName)
+			if err != nil {
+				d.logger.Warning("Unable to list registry tags of %s: %v", name, err)
+			}
+			candidates = append(candidates, tags...)
+		}
+		for _, candidate := range candidates {
+			parsed, err := parseVersion(policy, candidate)
+			// Pre-releases such as "-dirty" builds are not bumped from.
+			if err != nil || parsed.prerelease != "" {
+				continue
+			}
+			if latest == nil || parsed.compare(*latest) > 0 {
+				latest = &parsed
+			}
+		}
+	}
+
+	version, err := nextVersion(policy, latest, request.Bump, time.Now())
+	if err != nil {
+		return err
+	}
+	d.logger.Info("Bumped %s version: %s", request.Bump, version)
+	request.Version = version
+	return nil
+}
+
+// checkVersionPolicy validates the request version against the versioning
+// policy of each selected service, and warns about or blocks deploying a
+// version lower than the one running on the target server, or else the last
+// one deployed there.
+func (d *DeploymentService) checkVersionPolicy(request domain.DeploymentRequest, config *domain.Config) error {
+	for _, name := range requestedServices(request) {
+		serviceConfig := config.Services[name]
+		policy := serviceConfig.Versioning
+		if policy != versioningSemver && policy != versioningCalver {
+			continue
+		}
+
+		version, err := parseVersion(policy, request.Version)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		deployed := d.currentVersion(serviceConfig, config, request.DryRun)
+		if deployed == "" {
+			continue
+		}
+		current, err := parseVersion(policy, deployed)
+		if err != nil || version.compare(current) >= 0 {
+			continue
+		}
+		if serviceConfig.Downgrade == "block" && !request.AllowDowngrade {
+			return fmt.Errorf("%s: version %s is lower than the deployed %s, use -allow-downgrade to downgrade", name, request.Version, deployed)
+		}
+		d.logger.Warning("%s: deploying %s, which is lower than the deployed %s", name, request.Version, deployed)
+	}
+	return nil
+}
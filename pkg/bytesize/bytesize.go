@@ -0,0 +1,18 @@
+// Package bytesize formats byte counts for humans.
+package bytesize
+
+import "fmt"
+
+// Format returns n in binary units, e.g. "512 B" or "1.5 MB".
+func Format(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -1,8 +1,13 @@
 package logger
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"strings"
+	"sync"
+	"time"
 )
 
 // ANSI color codes
@@ -18,32 +23,143 @@ const (
 	Bold   = "\033[1m"
 )
 
+// Output formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Logger writes leveled messages as colored text or JSON lines. Child
+// loggers created with With share the output settings of their parent and
+// add their own fields.
 type Logger struct {
+	*output
+	fields map[string]string
+}
+
+// output holds the settings shared by a logger and its children.
+type output struct {
 	prefix string
+	format string
+	debug  bool
+	plain  bool
+
+	mu         sync.Mutex
+	transcript io.Writer
 }
 
 func New(prefix string) *Logger {
 	return &Logger{
-		prefix: prefix,
+		output: &output{prefix: prefix, format: FormatText},
+		fields: make(map[string]string),
+	}
+}
+
+// With returns a child logger attaching fields, such as the service being
+// deployed, to its JSON entries on top of the fields of l. Empty values are
+// left out.
+func (l *Logger) With(fields map[string]string) *Logger {
+	child := &Logger{output: l.output, fields: make(map[string]string, len(l.fields)+len(fields))}
+	for key, value := range l.fields {
+		child.fields[key] = value
+	}
+	for key, value := range fields {
+		if value != "" {
+			child.fields[key] = value
+		}
 	}
+	return child
+}
+
+// SetFormat selects colored text (the default) or one JSON object per line.
+func (l *Logger) SetFormat(format string) error {
+	switch format {
+	case FormatText, FormatJSON:
+		l.format = format
+		return nil
+	}
+	return fmt.Errorf("unknown log format '%s', expected text or json", format)
+}
+
+// Format returns the output format, FormatText or FormatJSON.
+func (l *Logger) Format() string {
+	return l.format
+}
+
+// SetColor turns the colors of text output on (the default) or off.
+func (l *Logger) SetColor(enabled bool) {
+	l.plain = !enabled
+}
+
+// SetDebug turns debug messages on or off.
+func (l *Logger) SetDebug(enabled bool) {
+	l.debug = enabled
+}
+
+// SetTranscript copies every entry, debug messages included, to w as
+// timestamped plain text, whatever the output format. A nil w stops copying.
+func (l *Logger) SetTranscript(w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.transcript = w
+}
+
+func (l *Logger) Debug(msg string, args ...interface{}) {
+	l.write("debug", Purple, "DEBUG", msg, args)
 }
 
 func (l *Logger) Info(msg string, args ...interface{}) {
-	formatted := fmt.Sprintf(msg, args...)
-	log.Printf("%s[INFO]%s %s", Cyan, Reset, formatted)
+	l.write("info", Cyan, "INFO", msg, args)
 }
 
 func (l *Logger) Error(msg string, args ...interface{}) {
-	formatted := fmt.Sprintf(msg, args...)
-	log.Printf("%s[ERROR]%s %s", Red, Reset, formatted)
+	l.write("error", Red, "ERROR", msg, args)
 }
 
 func (l *Logger) Warning(msg string, args ...interface{}) {
-	formatted := fmt.Sprintf(msg, args...)
-	log.Printf("%s[WARNING]%s %s", Yellow, Reset, formatted)
+	l.write("warning", Yellow, "WARNING", msg, args)
 }
 
 func (l *Logger) Success(msg string, args ...interface{}) {
+	l.write("success", Green, "SUCCESS", msg, args)
+}
+
+func (l *Logger) write(level, color, label, msg string, args []interface{}) {
 	formatted := fmt.Sprintf(msg, args...)
-	log.Printf("%s[SUCCESS]%s %s", Green, Reset, formatted)
-}
\ No newline at end of file
+	l.mu.Lock()
+	if l.transcript != nil {
+		fmt.Fprintf(l.transcript, "%s %-7s %s\n", time.Now().Format("2006-01-02 15:04:05.000"), label, strings.TrimRight(formatted, "\n"))
+	}
+	l.mu.Unlock()
+	if level == "debug" && !l.debug {
+		return
+	}
+
+	if l.format != FormatJSON {
+		prefix := ""
+		if l.prefix != "" {
+			prefix = l.prefix + ": "
+		}
+		if l.plain {
+			log.Printf("%s[%s] %s", prefix, label, formatted)
+		} else {
+			log.Printf("%s%s[%s]%s %s", prefix, color, label, Reset, formatted)
+		}
+		return
+	}
+
+	entry := map[string]string{
+		"timestamp": time.Now().UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+		"level":     level,
+		"message":   formatted,
+	}
+	if l.prefix != "" {
+		entry["logger"] = l.prefix
+	}
+	for key, value := range l.fields {
+		entry[key] = value
+	}
+
+	line, _ := json.Marshal(entry)
+	log.Writer().Write(append(line, '\n'))
+}
@@ -0,0 +1,23 @@
+package terminal
+
+import "os"
+
+// IsTerminal reports whether f is an interactive terminal rather than a
+// file or pipe.
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// ColorEnabled reports whether ANSI colors and cursor movement can be
+// written to f: it must be a terminal that understands escape sequences,
+// and neither NO_COLOR nor TERM=dumb may be set.
+func ColorEnabled(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return IsTerminal(f) && enableVT(f)
+}
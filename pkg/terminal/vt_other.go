@@ -0,0 +1,9 @@
+//go:build !windows
+
+package terminal
+
+import "os"
+
+func enableVT(f *os.File) bool {
+	return true
+}